@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jpillora/installer/handler"
+	"github.com/jpillora/installer/installer"
+)
+
+// generateCmd pre-renders a static site for a fixed list of repos,
+// so small projects can host scripts without running a server
+type generateCmd struct {
+	Repos string `opts:"help=file listing a user/repo[@release] per line (# starts a comment)"`
+	Out   string `opts:"help=output directory, default=./site"`
+	URL   string `opts:"help=base url the site will be served from (e.g. https://me.github.io/site)"`
+	Token string `opts:"help=github api token (for private repos and higher rate limits), env=GITHUB_TOKEN"`
+}
+
+// readRepos reads the queries listed in path
+func readRepos(path string) ([]installer.Query, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	queries := []installer.Query{}
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		line, _, _ := strings.Cut(s.Text(), "#")
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		q, err := parseRepo(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		queries = append(queries, q)
+	}
+	return queries, s.Err()
+}
+
+func (g *generateCmd) Run() error {
+	if g.Repos == "" || g.URL == "" {
+		return errors.New("--repos and --url are required")
+	}
+	queries, err := readRepos(g.Repos)
+	if err != nil {
+		return err
+	}
+	out := g.Out
+	if out == "" {
+		out = "site"
+	}
+	c := handler.DefaultConfig
+	c.Token = g.Token
+	r := installer.NewResolver(c)
+	if err := r.Generate(context.Background(), out, g.URL, queries); err != nil {
+		return err
+	}
+	fmt.Printf("Generated %d repos into %s\n", len(queries), out)
+	return nil
+}
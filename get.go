@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jpillora/installer/handler"
+	"github.com/jpillora/installer/installer"
+)
+
+// getCmd installs a release natively, without a shell script,
+// for hosts lacking curl, wget or a posix shell
+type getCmd struct {
+	Repo  string `opts:"mode=arg, help=user/repo to install (optionally pinned with @release)"`
+	Dir   string `opts:"help=install directory, default=~/.local/bin"`
+	As    string `opts:"help=install the binary under another name"`
+	Token string `opts:"help=github api token (for private repos and higher rate limits), env=GITHUB_TOKEN"`
+}
+
+// parseRepo reads user/repo[@release]
+func parseRepo(s string) (installer.Query, error) {
+	user, rest, _ := strings.Cut(s, "/")
+	program, release, _ := strings.Cut(rest, "@")
+	if user == "" || program == "" {
+		return installer.Query{}, errors.New("expected user/repo[@release]")
+	}
+	return installer.Query{User: user, Program: program, Release: release}, nil
+}
+
+func (g *getCmd) Run() error {
+	q, err := parseRepo(g.Repo)
+	if err != nil {
+		return err
+	}
+	q.AsProgram = g.As
+	dir := g.Dir
+	if dir == "" {
+		dir = "~/.local/bin"
+	}
+	if dir == "~" || strings.HasPrefix(dir, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return err
+		}
+		dir = filepath.Join(home, dir[1:])
+	}
+	c := handler.DefaultConfig
+	c.Token = g.Token
+	r := installer.NewResolver(c)
+	ctx := context.Background()
+	result, err := r.Resolve(ctx, q)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Installing %s/%s %s\n", result.User, result.Program, result.Release)
+	if a, err := r.Platform(result); err == nil && a.SHA256 == "" {
+		fmt.Fprintln(os.Stderr, "warning: no published checksum, skipping verification")
+	}
+	dest, err := r.Install(ctx, result, dir, g.As)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Installed at %s\n", dest)
+	return nil
+}
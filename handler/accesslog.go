@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// accessLog writes requests in the common or combined log format,
+// as understood by existing log pipelines (goaccess, awstats...)
+type accessLog struct {
+	mut      sync.Mutex
+	w        io.Writer
+	combined bool
+}
+
+// openAccessLog opens the configured access log file, where "-" is stdout
+func openAccessLog(path, format string) (*accessLog, error) {
+	if format == "" {
+		format = "combined"
+	}
+	if format != "common" && format != "combined" {
+		return nil, fmt.Errorf("unknown access log format %q", format)
+	}
+	a := &accessLog{w: os.Stdout, combined: format == "combined"}
+	if path != "-" {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+		if err != nil {
+			return nil, err
+		}
+		a.w = f
+	}
+	return a, nil
+}
+
+func (a *accessLog) log(r *http.Request, host string, start time.Time, status int, size int64) {
+	if host == "" {
+		host = "-"
+	}
+	bytes := "-"
+	if size > 0 {
+		bytes = strconv.FormatInt(size, 10)
+	}
+	line := fmt.Sprintf("%s - - [%s] %q %d %s", host, start.Format("02/Jan/2006:15:04:05 -0700"),
+		r.Method+" "+redactURI(r.URL)+" "+r.Proto, status, bytes)
+	if a.combined {
+		line += fmt.Sprintf(" %q %q", orDash(r.Referer()), orDash(r.UserAgent()))
+	}
+	a.mut.Lock()
+	defer a.mut.Unlock()
+	io.WriteString(a.w, line+"\n")
+}
+
+// redactURI hides credentials which may be passed as query params
+func redactURI(u *url.URL) string {
+	q := u.Query()
+	redacted := false
+	for _, k := range []string{"token", "key"} {
+		if q.Has(k) {
+			q.Set(k, "redacted")
+			redacted = true
+		}
+	}
+	if !redacted {
+		return u.RequestURI()
+	}
+	v := *u
+	v.RawQuery = q.Encode()
+	return v.RequestURI()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
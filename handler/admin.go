@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+//go:embed admin.html
+var dashboardHTML string
+
+var dashboard = template.Must(template.New("dashboard").Parse(dashboardHTML))
+
+// serveAdmin serves operator endpoints, which are
+// disabled unless basic auth or oidc is configured
+func (h *Handler) serveAdmin(w http.ResponseWriter, r *http.Request) {
+	if h.Config.AdminPassword == "" && h.oidc == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if !h.adminAuth(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="installer admin"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	switch r.URL.Path {
+	case "/admin/cache":
+		if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		n := h.invalidate(r.URL.Query().Get("repo"))
+		slog.Info("admin invalidated cache", "entries", n)
+		writeJSON(w, map[string]int{"invalidated": n})
+	case "/admin", "/admin/":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Content-Security-Policy", htmlCSP)
+		if err := dashboard.Execute(w, h.adminStats()); err != nil {
+			slog.Error("admin dashboard failed", "err", err)
+		}
+	case "/admin/stats":
+		writeJSON(w, h.adminStats())
+	case "/admin/config":
+		writeJSON(w, h.Config.redacted())
+	case "/admin/reload":
+		h.serveReload(w, r)
+	case "/admin/loglevel":
+		h.serveLogLevel(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+type adminStats struct {
+	Uptime       string         `json:"uptime"`
+	CacheEntries int            `json:"cache_entries"`
+	Backoff      string         `json:"backoff"`
+	Quota        *RateLimit     `json:"quota,omitempty"`
+	TopRepos     []repoCount    `json:"top_repos"`
+	RecentErrors []requestError `json:"recent_errors"`
+	Banner       []string       `json:"banner,omitempty"`
+}
+
+func (h *Handler) adminStats() adminStats {
+	entries := len(h.Cache.Keys())
+	wait := h.rateLimited()
+	if wait < 0 {
+		wait = 0
+	}
+	s := adminStats{
+		Uptime:       time.Since(h.started).Round(time.Second).String(),
+		CacheEntries: entries,
+		Backoff:      wait.Round(time.Second).String(),
+		TopRepos:     h.stats.top(20),
+		RecentErrors: h.stats.recent(),
+		Banner:       bannerLines(h.Config.Banner),
+	}
+	if q, ok := h.githubQuota(); ok {
+		s.Quota = &q
+	}
+	return s
+}
+
+// adminAuth accepts basic auth credentials or an oidc bearer token
+func (h *Handler) adminAuth(r *http.Request) bool {
+	if user, pass, ok := r.BasicAuth(); ok && h.Config.AdminPassword != "" {
+		userOK := subtle.ConstantTimeCompare([]byte(user), []byte(h.Config.AdminUser)) == 1
+		passOK := subtle.ConstantTimeCompare([]byte(pass), []byte(h.Config.AdminPassword)) == 1
+		return userOK && passOK
+	}
+	auth := r.Header.Get("Authorization")
+	if h.oidc == nil || !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+	claims, err := h.oidc.verify(r.Context(), strings.TrimPrefix(auth, "Bearer "))
+	if err != nil {
+		slog.Warn("admin token rejected", "err", err)
+		return false
+	}
+	if subjects := SplitList(h.Config.OIDCSubjects); !matchAny(subjects, claims.Subject) &&
+		(claims.Email == "" || !matchAny(subjects, claims.Email)) {
+		slog.Warn("admin subject not allowed", "sub", claims.Subject, "email", claims.Email)
+		return false
+	}
+	return true
+}
+
+// invalidate drops cached results for the given user/repo, or all when empty
+func (h *Handler) invalidate(repo string) int {
+	n := 0
+	for _, k := range h.Cache.Keys() {
+		result, ok := h.Cache.Get(k)
+		if ok && (repo == "" || strings.EqualFold(repo, result.User+"/"+result.Program)) {
+			h.Cache.Delete(k)
+			n++
+		}
+	}
+	return n
+}
+
+// redacted returns a copy of the config safe to display
+func (c Config) redacted() Config {
+	hide := func(s *string) {
+		if *s != "" {
+			*s = "<redacted>"
+		}
+	}
+	hide(&c.Token)
+	hide(&c.SigningKey)
+	hide(&c.AuditSalt)
+	hide(&c.AdminPassword)
+	hide(&c.QuotaWebhook)
+	hide(&c.ErrorWebhook)
+	hide(&c.SentryDSN)
+	//the proxy host is useful, its password isn't
+	if u, err := url.Parse(c.ProxyURL); err == nil {
+		c.ProxyURL = u.Redacted()
+	} else {
+		hide(&c.ProxyURL)
+	}
+	if len(c.APIKeys) > 0 {
+		c.APIKeys = []string{"<redacted>"}
+	}
+	return c
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
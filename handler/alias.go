@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"log/slog"
+	"sort"
+	"strings"
+)
+
+const maxSuggestions = 3
+
+// aliases map short names onto user/repo
+type aliases map[string]string
+
+// newAliases parses name=user/repo rules
+func newAliases(rules []string) aliases {
+	as := aliases{}
+	for _, rule := range rules {
+		name, repo := splitHalf(rule, "=")
+		name, repo = strings.TrimSpace(name), strings.TrimSpace(repo)
+		user, program := splitHalf(repo, "/")
+		if name == "" || user == "" || program == "" || strings.Contains(program, "/") {
+			slog.Warn("ignoring invalid alias, expected name=user/repo", "rule", rule)
+			continue
+		}
+		as[strings.ToLower(name)] = repo
+	}
+	return as
+}
+
+// suggest returns the aliases whose name or repo
+// closely resemble a program which was not found
+func (as aliases) suggest(program string) []string {
+	program = strings.ToLower(program)
+	if program == "" {
+		return nil
+	}
+	//allow more typos in longer names
+	max := 1
+	if len(program) > 4 {
+		max = 2
+	}
+	out := []string{}
+	for name, repo := range as {
+		_, p := splitHalf(strings.ToLower(repo), "/")
+		if name != program && safeNameRe.MatchString(name) && (editDistance(name, program) <= max || editDistance(p, program) <= max) {
+			out = append(out, name)
+		}
+	}
+	sort.Strings(out)
+	if len(out) > maxSuggestions {
+		out = out[:maxSuggestions]
+	}
+	return out
+}
+
+// lookup returns the user and repo of an alias
+func (as aliases) lookup(name string) (string, string, bool) {
+	repo, ok := as[strings.ToLower(name)]
+	if !ok {
+		return "", "", false
+	}
+	user, program := splitHalf(repo, "/")
+	return user, program, true
+}
@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// AuditEntry records a single served script
+type AuditEntry struct {
+	Time      time.Time `json:"time"`
+	User      string    `json:"user"`
+	Program   string    `json:"program"`
+	Release   string    `json:"release"`
+	Type      string    `json:"type"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	ClientID  string    `json:"client_id,omitempty"` //salted hash of the client ip
+}
+
+// AuditSink receives an entry for every served script
+type AuditSink interface {
+	Audit(AuditEntry)
+}
+
+// NewJSONAudit writes audit entries to w as JSON lines
+func NewJSONAudit(w io.Writer) AuditSink {
+	return &jsonAudit{enc: json.NewEncoder(w)}
+}
+
+type jsonAudit struct {
+	mut sync.Mutex
+	enc *json.Encoder
+}
+
+func (j *jsonAudit) Audit(e AuditEntry) {
+	j.mut.Lock()
+	defer j.mut.Unlock()
+	if err := j.enc.Encode(e); err != nil {
+		slog.Error("audit log failed", "err", err)
+	}
+}
+
+// openAudit opens the configured audit log file, where "-" is stdout
+func openAudit(path string) (AuditSink, error) {
+	if path == "-" {
+		return NewJSONAudit(os.Stdout), nil
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return nil, err
+	}
+	return NewJSONAudit(f), nil
+}
+
+// audit records a served script
+func (h *Handler) audit(r *http.Request, result Result, qtype string) {
+	if h.Audit == nil {
+		return
+	}
+	e := AuditEntry{
+		Time:      time.Now().UTC(),
+		User:      result.User,
+		Program:   result.Program,
+		Release:   result.Release,
+		Type:      qtype,
+		UserAgent: r.UserAgent(),
+	}
+	//even hashed ips are linkable while the salt is kept
+	if !h.Config.Privacy {
+		e.ClientID = h.clientID(clientIP(r, h.Config.TrustProxy))
+	}
+	h.Audit.Audit(e)
+}
+
+// clientID hashes an ip with the audit salt, so installs from the
+// same client can be correlated without retaining the ip itself
+func (h *Handler) clientID(ip string) string {
+	sum := sha256.Sum256([]byte(h.auditSalt + ip))
+	return hex.EncodeToString(sum[:8])
+}
+
+// randomSalt is used when no audit salt is configured
+func randomSalt() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Cache stores resolved releases by key, e.g. in an external store
+// shared by several instances. Results expire by their Timestamp,
+// so caches need not track expiry, though they may evict any time.
+type Cache interface {
+	Get(key string) (Result, bool)
+	Set(key string, result Result)
+	Delete(key string)
+	Keys() []string
+}
+
+// NewMemoryCache returns the default in-process cache
+func NewMemoryCache() Cache {
+	return &memoryCache{results: map[string]Result{}}
+}
+
+type memoryCache struct {
+	mut     sync.Mutex
+	results map[string]Result
+}
+
+func (m *memoryCache) Get(key string) (Result, bool) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	r, ok := m.results[key]
+	return r, ok
+}
+
+func (m *memoryCache) Set(key string, result Result) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	m.results[key] = result
+}
+
+func (m *memoryCache) Delete(key string) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	delete(m.results, key)
+}
+
+func (m *memoryCache) Keys() []string {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	keys := make([]string, 0, len(m.results))
+	for k := range m.results {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// NewDirCache stores each result as a JSON file in dir, so instances
+// sharing a volume (e.g. serverless functions mounting EFS or a
+// Cloud Storage bucket) share resolved releases. Failures are logged
+// and treated as misses.
+func NewDirCache(dir string) Cache {
+	return &dirCache{dir: dir}
+}
+
+type dirCache struct {
+	dir string
+}
+
+// path encodes key, which may contain slashes, as a file name
+func (d *dirCache) path(key string) string {
+	return filepath.Join(d.dir, base64.RawURLEncoding.EncodeToString([]byte(key))+".json")
+}
+
+func (d *dirCache) Get(key string) (Result, bool) {
+	b, err := os.ReadFile(d.path(key))
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			slog.Warn("cache read failed", "err", err)
+		}
+		return Result{}, false
+	}
+	r := Result{}
+	if err := json.Unmarshal(b, &r); err != nil {
+		slog.Warn("cache entry is invalid", "err", err)
+		return Result{}, false
+	}
+	return r, true
+}
+
+func (d *dirCache) Set(key string, result Result) {
+	b, err := json.Marshal(result)
+	if err == nil {
+		err = os.MkdirAll(d.dir, 0o755)
+	}
+	if err != nil {
+		slog.Warn("cache write failed", "err", err)
+		return
+	}
+	//write then rename, so concurrent readers never see partial entries
+	f, err := os.CreateTemp(d.dir, ".tmp-*")
+	if err != nil {
+		slog.Warn("cache write failed", "err", err)
+		return
+	}
+	_, err = f.Write(b)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), d.path(key))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		slog.Warn("cache write failed", "err", err)
+	}
+}
+
+func (d *dirCache) Delete(key string) {
+	if err := os.Remove(d.path(key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.Warn("cache delete failed", "err", err)
+	}
+}
+
+func (d *dirCache) Keys() []string {
+	entries, err := os.ReadDir(d.dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.Warn("cache list failed", "err", err)
+	}
+	keys := []string{}
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".json")
+		if !ok {
+			continue
+		}
+		if key, err := base64.RawURLEncoding.DecodeString(name); err == nil {
+			keys = append(keys, string(key))
+		}
+	}
+	return keys
+}
@@ -0,0 +1,267 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	githubAPI        = "https://api.github.com"
+	maxAttempts      = 4
+	retryBackoff     = 250 * time.Millisecond
+	rateLimitBackoff = time.Minute
+	//upstream response limits
+	maxJSONSize  = 16 << 20
+	maxErrorSize = 64 << 10
+	maxSumsSize  = 64 << 10
+	maxAssets    = 500
+)
+
+var (
+	errRateLimited = errors.New("github rate limit exceeded")
+	errTooLarge    = errors.New("upstream response too large")
+)
+
+// Version of the installer, sent upstream in the User-Agent
+var Version = "0.0.0-src"
+
+// userAgent identifies this service to github, as github requires
+func (h *Handler) userAgent() string {
+	ua := "jpillora-installer/" + Version + " (+https://github.com/jpillora/installer)"
+	if h.Config.UserAgent != "" {
+		ua += " " + h.Config.UserAgent
+	}
+	return ua
+}
+
+// apiURL returns the github api base url, without a trailing slash
+func (h *Handler) apiURL() string {
+	if h.Config.APIURL != "" {
+		return strings.TrimSuffix(h.Config.APIURL, "/")
+	}
+	return githubAPI
+}
+
+// mirrorURL rewrites api urls returned by github onto the configured api base
+func (h *Handler) mirrorURL(u string) string {
+	if base := h.apiURL(); base != githubAPI && strings.HasPrefix(u, githubAPI+"/") {
+		return base + strings.TrimPrefix(u, githubAPI)
+	}
+	return u
+}
+
+// client returns the http client used for all outbound requests
+func (h *Handler) client() *http.Client {
+	c, _ := h.outbound()
+	return c
+}
+
+// outbound returns the http client and its ssrf guard,
+// built from the current config
+func (h *Handler) outbound() (*http.Client, *guard) {
+	h.clientMut.Lock()
+	defer h.clientMut.Unlock()
+	if h.httpClient == nil {
+		h.guard = newGuard(h.Config)
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		t.DialContext = h.guard.dial
+		t.Proxy = http.ProxyFromEnvironment
+		if h.Config.ProxyURL != "" {
+			if u, err := url.Parse(h.Config.ProxyURL); err != nil {
+				slog.Warn("invalid proxy url, using environment", "err", err)
+			} else {
+				t.Proxy = http.ProxyURL(u)
+			}
+		}
+		t.Proxy = h.guard.proxy(t.Proxy)
+		h.httpClient = &http.Client{
+			Transport:     tracedTransport(t),
+			CheckRedirect: h.guard.checkRedirect,
+		}
+	}
+	return h.httpClient, h.guard
+}
+
+// resetClient rebuilds the client on next use, so reloaded
+// upstreams and proxies are used (and trusted) immediately
+func (h *Handler) resetClient() {
+	h.clientMut.Lock()
+	defer h.clientMut.Unlock()
+	if h.httpClient != nil {
+		h.httpClient.CloseIdleConnections()
+	}
+	h.httpClient, h.guard = nil, nil
+}
+
+// guardURL checks an outbound url against the ssrf guard
+func (h *Handler) guardURL(u *url.URL) error {
+	_, g := h.outbound()
+	return g.checkURL(u)
+}
+
+// do performs the given (bodiless) request, retrying transient
+// failures with a jittered exponential backoff
+func (h *Handler) do(req *http.Request) (*http.Response, error) {
+	if err := h.guardURL(req.URL); err != nil {
+		return nil, err
+	}
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", h.userAgent())
+	}
+	for attempt := 1; ; attempt++ {
+		resp, err := h.client().Do(req)
+		if attempt == maxAttempts || req.Context().Err() != nil || !retryable(resp, err) {
+			return resp, err
+		}
+		if resp != nil {
+			//drain so the connection can be reused
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		//250ms, 500ms, 1s... plus up to 50% jitter
+		d := retryBackoff << (attempt - 1)
+		d += time.Duration(rand.Int63n(int64(d / 2)))
+		slog.Info("retrying upstream request", "url", req.URL.Redacted(), "wait", d, "attempt", attempt, "max", maxAttempts)
+		select {
+		case <-time.After(d):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+}
+
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		var nerr net.Error
+		if errors.As(err, &nerr) && nerr.Timeout() {
+			return true
+		}
+		return errors.Is(err, syscall.ECONNRESET) ||
+			errors.Is(err, syscall.ECONNREFUSED) ||
+			errors.Is(err, io.ErrUnexpectedEOF) ||
+			errors.Is(err, io.EOF)
+	}
+	switch resp.StatusCode {
+	case http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// rateLimitWait inspects a github error response for primary and
+// secondary rate limits, returning how long github asked us to wait
+func rateLimitWait(resp *http.Response, body []byte) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+	if s, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		return time.Duration(s) * time.Second, true
+	}
+	if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			return time.Until(time.Unix(reset, 0)), true
+		}
+	}
+	msg := strings.ToLower(string(body))
+	if strings.Contains(msg, "secondary rate limit") || strings.Contains(msg, "abuse detection") {
+		return rateLimitBackoff, true
+	}
+	return 0, false
+}
+
+// backoff stops requests to github for the given duration
+func (h *Handler) backoff(d time.Duration) {
+	if d < time.Second {
+		d = time.Second
+	}
+	h.limitMut.Lock()
+	defer h.limitMut.Unlock()
+	if until := time.Now().Add(d); until.After(h.limitedUntil) {
+		h.limitedUntil = until
+	}
+}
+
+// observeQuota records the quota github reports for the server's token
+func (h *Handler) observeQuota(resp *http.Response) {
+	//only track the core api, not the search quota
+	if res := resp.Header.Get("X-RateLimit-Resource"); res != "" && res != "core" {
+		return
+	}
+	remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	limit, _ := strconv.Atoi(resp.Header.Get("X-RateLimit-Limit"))
+	reset, _ := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+	h.limitMut.Lock()
+	defer h.limitMut.Unlock()
+	h.quota = RateLimit{Limit: limit, Remaining: remaining, Reset: time.Unix(reset, 0)}
+	//alert once each time the quota drops below the threshold
+	low := remaining < h.Config.QuotaAlert
+	if low && !h.quotaAlerted {
+		slog.Warn("github quota is low", "remaining", remaining, "limit", limit)
+		if h.Config.QuotaWebhook != "" {
+			b, _ := json.Marshal(map[string]interface{}{
+				"text":      "installer: " + h.quotaWarningLocked(),
+				"remaining": remaining,
+				"limit":     limit,
+				"reset":     h.quota.Reset.UTC(),
+			})
+			go h.postWebhook(h.Config.QuotaWebhook, b)
+		}
+	}
+	h.quotaAlerted = low
+}
+
+// quotaWarning describes the github quota when it is below the alert threshold
+func (h *Handler) quotaWarning() string {
+	h.limitMut.Lock()
+	defer h.limitMut.Unlock()
+	if h.quota.Limit == 0 || h.quota.Remaining >= h.Config.QuotaAlert {
+		return ""
+	}
+	return h.quotaWarningLocked()
+}
+
+func (h *Handler) quotaWarningLocked() string {
+	return fmt.Sprintf("low on github api quota (%d of %d requests remaining until %s), installs may soon fail",
+		h.quota.Remaining, h.quota.Limit, h.quota.Reset.UTC().Format("15:04 MST"))
+}
+
+// githubQuota returns the last observed quota, if any
+func (h *Handler) githubQuota() (RateLimit, bool) {
+	h.limitMut.Lock()
+	defer h.limitMut.Unlock()
+	return h.quota, h.quota.Limit > 0
+}
+
+// rateLimited returns how much longer github requests are on hold
+func (h *Handler) rateLimited() time.Duration {
+	h.limitMut.Lock()
+	defer h.limitMut.Unlock()
+	return time.Until(h.limitedUntil)
+}
+
+// decodeJSON decodes at most maxJSONSize bytes of r into v
+func decodeJSON(r io.Reader, v interface{}) error {
+	b, err := io.ReadAll(io.LimitReader(r, maxJSONSize+1))
+	if err != nil {
+		return err
+	}
+	if len(b) > maxJSONSize {
+		return errTooLarge
+	}
+	return json.Unmarshal(b, v)
+}
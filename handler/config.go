@@ -1,17 +1,106 @@
 package handler
 
+import "time"
+
 // Config installer handler
 type Config struct {
-	Host      string `opts:"help=host, env=HTTP_HOST"`
-	Port      int    `opts:"help=port, env"`
-	User      string `opts:"help=default user when not provided in URL, env"`
-	Token     string `opts:"help=github api token, env=GITHUB_TOKEN"`
-	ForceUser string `opts:"help=lock installer to a single user, env=FORCE_USER"`
-	ForceRepo string `opts:"help=lock installer to a single repo, env=FORCE_REPO"`
+	Host             string        `opts:"help=host, env=HTTP_HOST"`
+	Port             int           `opts:"help=port, env"`
+	ACMEDomains      []string      `opts:"help=serve https using lets encrypt certificates for these domains, env=ACME_DOMAINS"`
+	ACMEDir          string        `opts:"help=directory to cache lets encrypt certificates, env=ACME_DIR"`
+	ACMEEmail        string        `opts:"help=contact email for lets encrypt, env=ACME_EMAIL"`
+	ACMEHTTPPort     int           `opts:"help=port serving http-01 challenges and https redirects (0 disables), env=ACME_HTTP_PORT"`
+	User             string        `opts:"help=default user when not provided in URL, env"`
+	Token            string        `opts:"help=github api token, env=GITHUB_TOKEN"`
+	APIURL           string        `opts:"help=github api base url (e.g. an internal caching mirror), env=GITHUB_API_URL"`
+	AssetMirror      string        `opts:"help=download release assets from this base url instead of https://github.com (e.g. an internal mirror), env=ASSET_MIRROR"`
+	AllowedMirrors   []string      `opts:"help=asset mirror base urls clients may choose with ?mirror=, env=ALLOWED_MIRRORS"`
+	StrictToken      bool          `opts:"help=exit on startup when the github token is invalid, env=STRICT_TOKEN"`
+	Passthrough      bool          `opts:"help=forward client supplied github tokens upstream, env=TOKEN_PASSTHROUGH"`
+	Aliases          []string      `opts:"help=short names for repos as name=user/repo (e.g. rg=BurntSushi/ripgrep), env=ALIASES"`
+	SubdomainBase    string        `opts:"help=resolve repos from subdomains of this domain as repo or user--repo (e.g. ripgrep.i.example.com), env=SUBDOMAIN_BASE"`
+	ForceUser        string        `opts:"help=lock installer to a single user (or a list of glob patterns), env=FORCE_USER"`
+	ForceRepo        string        `opts:"help=lock installer to a single repo (or a list of glob patterns), env=FORCE_REPO"`
+	UserAgent        string        `opts:"help=suffix appended to the User-Agent sent upstream (e.g. a contact address), env=USER_AGENT"`
+	AllowUsers       []string      `opts:"help=only serve repos from these users/orgs (glob patterns), env=ALLOW_USERS"`
+	DenyRepos        []string      `opts:"help=never serve these user/repo glob patterns, env=DENY_REPOS"`
+	HTTPSOnly        bool          `opts:"help=refuse insecure=1 and assets not served over https, env=HTTPS_ONLY"`
+	RequireChecksums bool          `opts:"help=only serve assets with a published sha256 checksum, env=REQUIRE_CHECKSUMS"`
+	Banner           string        `opts:"help=lines shown atop every generated script and page such as a support contact (\\n separates lines), env=BANNER"`
+	TemplateDir      string        `opts:"help=directory of install.sh.tmpl/install.rb.tmpl/install.txt.tmpl files overriding the built in templates, env=TEMPLATE_DIR"`
+	SigningKey       string        `opts:"help=base64 ed25519 seed used to sign scripts served at <path>.sig, env=SIGNING_KEY"`
+	MinStars         int           `opts:"help=refuse repos with fewer github stars (0 disables), env=MIN_STARS"`
+	MinRepoAge       time.Duration `opts:"help=refuse repos created more recently than this (0 disables), env=MIN_REPO_AGE"`
+	APIKeys          []string      `opts:"help=require one of these keys via the X-API-Key header or ?key=, env=API_KEYS"`
+	AuditLog         string        `opts:"help=append a JSON line per served script to this file (- for stdout), env=AUDIT_LOG"`
+	AuditSalt        string        `opts:"help=salt for client ip hashes in the audit log (defaults to random), env=AUDIT_SALT"`
+	CSP              string        `opts:"help=Content-Security-Policy response header (empty disables), env=CSP"`
+	ReferrerPolicy   string        `opts:"help=Referrer-Policy response header (empty disables), env=REFERRER_POLICY"`
+	RobotsFile       string        `opts:"help=serve this file as robots.txt (defaults to disallowing all crawlers), env=ROBOTS_FILE"`
+	SecurityContacts []string      `opts:"help=emails or urls listed in /.well-known/security.txt (unset disables), env=SECURITY_CONTACTS"`
+	CORSOrigins      []string      `opts:"help=browser origins allowed to fetch json results (glob patterns or *), env=CORS_ORIGINS"`
+	CORSMethods      string        `opts:"help=comma separated methods allowed in cors preflight responses, env=CORS_METHODS"`
+	AdminUser        string        `opts:"help=username for the /admin endpoints, env=ADMIN_USER"`
+	AdminPassword    string        `opts:"help=password for the /admin endpoints (basic auth), env=ADMIN_PASSWORD"`
+	OIDCIssuer       string        `opts:"help=accept id tokens from this openid connect issuer on /admin, env=OIDC_ISSUER"`
+	OIDCAudience     string        `opts:"help=required audience of /admin id tokens, env=OIDC_AUDIENCE"`
+	OIDCSubjects     []string      `opts:"help=id token subjects or emails allowed on /admin (glob patterns) and required with an oidc issuer, env=OIDC_SUBJECTS"`
+	LogLevel         string        `opts:"help=minimum log level: debug info warn or error, env=LOG_LEVEL"`
+	LogFormat        string        `opts:"help=log format: text or json, env=LOG_FORMAT"`
+	StatsFile        string        `opts:"help=persist install counts to this json file, env=STATS_FILE"`
+	AccessLog        string        `opts:"help=write an access log to this file (- for stdout), env=ACCESS_LOG"`
+	AccessLogFormat  string        `opts:"help=access log format: common or combined, env=ACCESS_LOG_FORMAT"`
+	Privacy          bool          `opts:"help=never retain client ips: omit them from request logs and audit entries, env=PRIVACY_MODE"`
+	TrustProxy       bool          `opts:"help=trust X-Forwarded-For for client addresses (only behind a proxy which sets it), env=TRUST_PROXY"`
+	RateLimit        int           `opts:"help=maximum requests per minute per client ip (0 disables), env=RATE_LIMIT"`
+	RepoLimit        int           `opts:"help=maximum requests per minute per repo (0 disables), env=REPO_RATE_LIMIT"`
+	OrgQuotas        []string      `opts:"help=installs per hour allowed for each matching github user or org as pattern=limit (e.g. myorg=100 or *=1000), env=ORG_QUOTAS"`
+	AllowPrivate     bool          `opts:"help=allow upstream requests to private networks (disables the ssrf guard), env=ALLOW_PRIVATE"`
+	ProxyURL         string        `opts:"help=proxy for outbound requests (defaults to HTTP_PROXY/HTTPS_PROXY/NO_PROXY), env=PROXY_URL"`
+	DebugAddr        string        `opts:"help=serve pprof and expvar on this separate address (e.g. localhost:6060), env=DEBUG_ADDR"`
+	QuotaAlert       int           `opts:"help=alert when fewer github api requests remain (0 disables), env=QUOTA_ALERT_THRESHOLD"`
+	QuotaWebhook     string        `opts:"help=post low quota alerts as json to this (slack compatible) webhook, env=QUOTA_WEBHOOK_URL"`
+	SentryDSN        string        `opts:"help=report unexpected errors to sentry, env=SENTRY_DSN"`
+	ErrorWebhook     string        `opts:"help=post unexpected errors as json to this (slack compatible) webhook, env=ERROR_WEBHOOK_URL"`
+	OTLPEndpoint     string        `opts:"help=export traces to this otlp/http collector (e.g. http://localhost:4318), env=OTEL_EXPORTER_OTLP_ENDPOINT"`
+	SelfTestRepo     string        `opts:"help=periodically resolve this known-good user/repo and export the outcome as metrics, env=SELF_TEST_REPO"`
+	SelfTestInterval time.Duration `opts:"help=time between self tests, env=SELF_TEST_INTERVAL"`
+	ReadyRemaining   int           `opts:"help=minimum remaining github api requests for /readyz to report ready, env=READY_MIN_REMAINING"`
+	Timeout          time.Duration `opts:"help=maximum time spent resolving a single request, env=RESOLVE_TIMEOUT"`
+	CacheTTL         time.Duration `opts:"help=how long resolved releases are cached, env=CACHE_TTL"`
+	CacheDir         string        `opts:"help=cache resolved releases in this directory instead of memory (e.g. a volume shared by serverless instances), env=CACHE_DIR"`
+	TapRepos         []string      `opts:"help=serve a homebrew tap of these user/repos at /homebrew-tap, env=TAP_REPOS"`
+	ScoopRepos       []string      `opts:"help=serve a scoop bucket of these user/repos at /scoop-bucket, env=SCOOP_REPOS"`
+	Suggest          bool          `opts:"help=search github for did you mean suggestions when a repo is not found, env=SUGGEST"`
+	ConfigFile       string        `opts:"help=json/yaml/toml file of settings applied over flags and env (reloaded on change or SIGHUP) and the only way to set Tenants and Overrides, env=CONFIG_FILE"`
+
+	//Tenants override settings by host (or glob pattern),
+	//and can only be set with the ConfigFile
+	Tenants map[string]Tenant `opts:"-"`
+	//Overrides adjust scripts by user/repo,
+	//and can only be set with the ConfigFile
+	Overrides map[string]Override `opts:"-"`
+	//base is the config before ConfigFile was applied, so
+	//reloads start over instead of merging into old settings
+	base *Config
 }
 
 // DefaultConfig for an installer handler
 var DefaultConfig = Config{
-	Port: 3000,
-	User: "jpillora",
+	Port:             3000,
+	ACMEDir:          "certs",
+	User:             "jpillora",
+	ReadyRemaining:   10,
+	SelfTestInterval: 5 * time.Minute,
+	Timeout:          30 * time.Second,
+	CacheTTL:         time.Hour,
+	Suggest:          true,
+	//scripts and text never need to load anything
+	CSP:             "default-src 'none'; frame-ancestors 'none'",
+	ReferrerPolicy:  "no-referrer",
+	CORSMethods:     "GET,HEAD,OPTIONS",
+	AdminUser:       "admin",
+	LogLevel:        "info",
+	LogFormat:       "text",
+	AccessLogFormat: "combined",
 }
@@ -0,0 +1,30 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+)
+
+// cors sets cross origin headers for allowed browser origins,
+// returning true when the request was a preflight and is complete
+func (h *Handler) cors(w http.ResponseWriter, r *http.Request) bool {
+	origins := SplitList(h.Config.CORSOrigins)
+	origin := r.Header.Get("Origin")
+	if len(origins) == 0 || origin == "" {
+		return false
+	}
+	w.Header().Add("Vary", "Origin")
+	if !matchAny(origins, origin) {
+		return false
+	}
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	w.Header().Set("Access-Control-Expose-Headers", "X-Script-SHA256, Retry-After")
+	if r.Method != http.MethodOptions || r.Header.Get("Access-Control-Request-Method") == "" {
+		return false
+	}
+	w.Header().Set("Access-Control-Allow-Methods", strings.Join(SplitList([]string{h.Config.CORSMethods}), ", "))
+	w.Header().Set("Access-Control-Allow-Headers", "Authorization, X-API-Key")
+	w.Header().Set("Access-Control-Max-Age", "3600")
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// errorPage is rendered by the error templates, its
+// message is stripped of shell and html meta characters
+type errorPage struct {
+	Status      int
+	Message     string
+	RequestID   string
+	Home        string
+	Suggestions []string //did you mean, e.g. close aliases
+}
+
+// errorTemplate picks the error template of a response type,
+// browsers are shown a page instead of text
+func errorTemplate(r *http.Request, qtype string) (string, string) {
+	switch {
+	case qtype == "script", qtype == "uninstall":
+		return "error-script", "text/plain; charset=utf-8"
+	case qtype == "text" && strings.Contains(r.Header.Get("Accept"), "text/html"):
+		return "error-html", "text/html; charset=utf-8"
+	}
+	return "error-text", "text/plain; charset=utf-8"
+}
+
+// writeError renders an error page, falling back to
+// plain text when the templates are broken
+func (h *Handler) writeError(w http.ResponseWriter, r *http.Request, qtype string, page errorPage) {
+	name, ctype := errorTemplate(r, qtype)
+	buff := bytes.Buffer{}
+	if err := h.renderError(&buff, name, page); err != nil {
+		slog.Warn("error template failed", "template", name, "err", err)
+		http.Error(w, page.Message+" request id: "+page.RequestID, page.Status)
+		return
+	}
+	w.Header().Del("Content-Length")
+	w.Header().Set("Content-Type", ctype)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if name == "error-html" && h.Config.CSP != "" {
+		w.Header().Set("Content-Security-Policy", htmlCSP)
+	}
+	w.WriteHeader(page.Status)
+	w.Write(buff.Bytes())
+}
+
+// renderError executes the named error template
+func (h *Handler) renderError(w io.Writer, name string, page errorPage) error {
+	if name == "error-html" {
+		t, err := h.errorHTML()
+		if err != nil {
+			return err
+		}
+		return t.Execute(w, page)
+	}
+	ts, err := h.templates()
+	if err != nil {
+		return err
+	}
+	return ts.ExecuteTemplate(w, name, page)
+}
+
+// requestedProgram returns the program name of a path,
+// e.g. /user/repo@v1.2.3! is repo
+func requestedProgram(path string) string {
+	path = strings.TrimSuffix(strings.Trim(path, "/"), ".sig")
+	path = strings.TrimRight(path, "!")
+	if strings.Contains(path, ",") {
+		return ""
+	}
+	path, _, _ = strings.Cut(path, "@")
+	return path[strings.LastIndex(path, "/")+1:]
+}
@@ -0,0 +1,210 @@
+package handler
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxGitCommits bounds the history kept in memory
+const maxGitCommits = 100
+
+// gitRepo is an in-memory git repository served with git's dumb http
+// protocol, so clients which only clone (brew tap, scoop bucket add)
+// can fetch generated files. Each change is committed on top of the
+// previous head, keeping updates fast forward, until maxGitCommits
+// when the history starts over as it would on a restart.
+type gitRepo struct {
+	mut     sync.Mutex
+	head    string
+	tree    string
+	commits int
+	files   map[string][]byte
+	objects map[string][]byte //zlib compressed loose objects by id
+}
+
+// object stores a loose object, returning its id
+func (g *gitRepo) object(kind string, content []byte) string {
+	raw := append([]byte(fmt.Sprintf("%s %d\x00", kind, len(content))), content...)
+	sum := sha1.Sum(raw)
+	id := hex.EncodeToString(sum[:])
+	if _, ok := g.objects[id]; !ok {
+		buff := bytes.Buffer{}
+		z := zlib.NewWriter(&buff)
+		z.Write(raw)
+		z.Close()
+		g.objects[id] = buff.Bytes()
+	}
+	return id
+}
+
+// writeTree stores the tree of files by slash separated path
+func (g *gitRepo) writeTree(files map[string][]byte) string {
+	dirs := map[string]map[string][]byte{}
+	//git orders entries by name, with directories as name/
+	entries := map[string]string{}
+	for path, content := range files {
+		if dir, rest, ok := strings.Cut(path, "/"); ok {
+			if dirs[dir] == nil {
+				dirs[dir] = map[string][]byte{}
+			}
+			dirs[dir][rest] = content
+			continue
+		}
+		entries[path] = "100644 " + path + "\x00" + rawID(g.object("blob", content))
+	}
+	for dir, files := range dirs {
+		entries[dir+"/"] = "40000 " + dir + "\x00" + rawID(g.writeTree(files))
+	}
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	tree := strings.Builder{}
+	for _, name := range names {
+		tree.WriteString(entries[name])
+	}
+	return g.object("tree", []byte(tree.String()))
+}
+
+func rawID(id string) string {
+	b, _ := hex.DecodeString(id)
+	return string(b)
+}
+
+// update commits files when they changed
+func (g *gitRepo) update(files map[string][]byte, message string) {
+	g.mut.Lock()
+	defer g.mut.Unlock()
+	if g.objects == nil {
+		g.objects = map[string][]byte{}
+	}
+	tree := g.writeTree(files)
+	if tree == g.tree {
+		return
+	}
+	//drop the old objects, rather than growing with every change
+	if g.commits >= maxGitCommits {
+		g.head, g.commits = "", 0
+		g.objects = map[string][]byte{}
+		tree = g.writeTree(files)
+	}
+	//first commits are reproducible, so restarting
+	//with unchanged files keeps the same head
+	when := int64(0)
+	parent := ""
+	if g.head != "" {
+		when = time.Now().Unix()
+		parent = "parent " + g.head + "\n"
+	}
+	sig := fmt.Sprintf("installer <installer@localhost> %d +0000", when)
+	commit := fmt.Sprintf("tree %s\n%sauthor %s\ncommitter %s\n\n%s\n", tree, parent, sig, sig, message)
+	g.head = g.object("commit", []byte(commit))
+	g.commits++
+	g.tree = tree
+	g.files = files
+}
+
+// file returns the committed content of path
+func (g *gitRepo) file(path string) ([]byte, bool) {
+	g.mut.Lock()
+	defer g.mut.Unlock()
+	b, ok := g.files[path]
+	return b, ok
+}
+
+// built reports whether anything was committed yet
+func (g *gitRepo) built() bool {
+	g.mut.Lock()
+	defer g.mut.Unlock()
+	return g.head != ""
+}
+
+// serve answers the dumb http protocol for path within the repo,
+// reporting false for other paths
+func (g *gitRepo) serve(w http.ResponseWriter, path string) bool {
+	g.mut.Lock()
+	defer g.mut.Unlock()
+	w.Header().Set("Content-Type", "text/plain")
+	switch {
+	case path == "info/refs":
+		//without the smart content type, git falls back to dumb http
+		w.Header().Set("Cache-Control", "no-cache")
+		fmt.Fprintf(w, "%s\trefs/heads/main\n", g.head)
+	case path == "HEAD":
+		w.Header().Set("Cache-Control", "no-cache")
+		fmt.Fprint(w, "ref: refs/heads/main\n")
+	case path == "objects/info/packs":
+		//no packs, only loose objects
+	case strings.HasPrefix(path, "objects/") && len(path) == len("objects/")+41 && path[len("objects/")+2] == '/':
+		id := strings.Replace(strings.TrimPrefix(path, "objects/"), "/", "", 1)
+		object, ok := g.objects[id]
+		if !ok {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return true
+		}
+		//objects never change
+		w.Header().Set("Content-Type", "application/x-git-loose-object")
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		w.Write(object)
+	default:
+		return false
+	}
+	return true
+}
+
+// serveGit serves g at root, refreshing it when clients
+// look for updates, objects are only requested after that
+func (h *Handler) serveGit(w http.ResponseWriter, r *http.Request, g *gitRepo, root string, refresh func(context.Context) error) {
+	path := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, root), "/")
+	if path == "info/refs" || path == "HEAD" || !g.built() {
+		if err := refresh(r.Context()); err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+	}
+	// files are also browsable, e.g. to review them
+	if path == "" {
+		path = "README.md"
+	}
+	if b, ok := g.file(path); ok {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write(b)
+		return
+	}
+	if !g.serve(w, path) {
+		http.Error(w, "Not found", http.StatusNotFound)
+	}
+}
+
+// gitReadme describes a generated repository of repos
+func gitReadme(title string, repos []string) []byte {
+	return []byte(fmt.Sprintf("# %s\n\nGenerated by [installer](https://github.com/jpillora/installer) "+
+		"from the latest github releases of:\n\n* %s\n", title, strings.Join(SplitList(repos), "\n* ")))
+}
+
+// resolveRepo resolves the latest release of a configured user/repo
+func (h *Handler) resolveRepo(ctx context.Context, repo string) (Result, error) {
+	q := Query{RequireChecksum: h.Config.RequireChecksums}
+	q.User, q.Program = splitHalf(repo, "/")
+	if err := q.validate(); err != nil {
+		return Result{}, err
+	}
+	result, err := h.execute(ctx, q)
+	if err != nil {
+		return Result{}, err
+	}
+	if err := result.validate(); err != nil {
+		return Result{}, err
+	}
+	return result, nil
+}
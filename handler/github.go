@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var errBadToken = errors.New("github token is invalid")
+
+// RateLimit is the github api quota of a token
+type RateLimit struct {
+	Limit     int
+	Remaining int
+	Reset     time.Time
+	//Scopes are the oauth scopes of classic tokens,
+	//fine-grained and app tokens report none
+	Scopes []string
+}
+
+// CheckToken verifies the configured github token against the
+// rate limit endpoint, which does not count against the quota
+func (h *Handler) CheckToken(ctx context.Context) (RateLimit, error) {
+	rl := RateLimit{}
+	req, _ := http.NewRequestWithContext(ctx, "GET", h.apiURL()+"/rate_limit", nil)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	if h.Config.Token != "" {
+		req.Header.Set("Authorization", "token "+h.Config.Token)
+	}
+	resp, err := h.do(req)
+	if err != nil {
+		return rl, fmt.Errorf("request failed: %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized {
+		return rl, errBadToken
+	}
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorSize))
+		return rl, errors.New(http.StatusText(resp.StatusCode) + " " + string(b))
+	}
+	ghrl := struct {
+		Resources struct {
+			Core struct {
+				Limit     int   `json:"limit"`
+				Remaining int   `json:"remaining"`
+				Reset     int64 `json:"reset"`
+			} `json:"core"`
+		} `json:"resources"`
+	}{}
+	if err := decodeJSON(resp.Body, &ghrl); err != nil {
+		return rl, fmt.Errorf("invalid rate limit response: %s", err)
+	}
+	core := ghrl.Resources.Core
+	rl.Limit = core.Limit
+	rl.Remaining = core.Remaining
+	rl.Reset = time.Unix(core.Reset, 0)
+	for _, s := range strings.Split(resp.Header.Get("X-OAuth-Scopes"), ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			rl.Scopes = append(rl.Scopes, s)
+		}
+	}
+	return rl, nil
+}
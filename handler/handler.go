@@ -2,38 +2,66 @@ package handler
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"regexp"
+	"runtime/debug"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"text/template"
 	"time"
-
-	"github.com/jpillora/installer/scripts"
 )
 
 const (
-	cacheTTL = time.Hour
+	cacheTTL    = time.Hour
+	maxPrograms = 10
+	//multi program scripts download this many at once
+	maxDownloads = 4
 )
 
 var (
 	isTermRe     = regexp.MustCompile(`(?i)^(curl|wget)\/`)
 	isHomebrewRe = regexp.MustCompile(`(?i)^homebrew`)
+	isBusyBoxRe  = regexp.MustCompile(`^Wget$`) // busybox wget sends no version
+	isPwshRe     = regexp.MustCompile(`(?i)powershell/`)
 	errMsgRe     = regexp.MustCompile(`[^A-Za-z0-9\ :\/\.]`)
 	errNotFound  = errors.New("not found")
+	errForbidden = errors.New("forbidden")
 )
 
 type Query struct {
 	User, Program, AsProgram, Release string
+	Dir                               string // install directory, may start with ~
+	Sudo                              string // never, auto (default) or always
+	Versioned                         bool   // install as name-version, linked from name
+	Versions                          string // keep every version under ~/.installer, switched with <program>-use
+	Debug                             bool   // trace the script and explain its decisions
+	Quiet                             bool   // no progress output, for CI logs
+	DryRun                            bool   // only print what the script would do
+	Proxy                             string // baked into the script, overriding the environment
+	AddPath                           bool   // append user-local install dirs to the shell rc file
+	Force                             bool   // reinstall even when the release is already installed
+	Upgrade                           bool   // only replace an existing install, wherever it is
+	Helper                            bool   // write a <program>-update helper beside the program
+	Completions                       bool   // install the shell completions the program generates
+	Man                               bool   // install man pages shipped in the release
+	Verify                            string // codesign (abort) or codesign-warn, checking macOS signatures
 	MoveToPath, Google, Insecure      bool
-	SudoMove                          bool // deprecated: not used, now automatically detected
+	RequireChecksum                   bool
+	Unpopular                         bool   // skip the minimum popularity guard
+	SudoMove                          bool   // deprecated: not used, now automatically detected
+	Token                             string `json:"-"` // client supplied github token
 }
 
 type Result struct {
@@ -41,6 +69,98 @@ type Result struct {
 	Timestamp time.Time
 	Assets    Assets
 	M1Asset   bool
+	Private   bool
+	Home      string   `json:"-"` // this server's homepage
+	Banner    []string `json:"-"` // operator notice shown atop scripts
+	//VersionCommand prints the installed version, to skip reinstalls
+	VersionCommand string `json:",omitempty"`
+	//CompletionCommand prints completions for {shell}
+	CompletionCommand string `json:",omitempty"`
+	//Files are pattern=destination rules for auxiliary files
+	Files []string `json:",omitempty"`
+	//UpdateURL is fetched by the <program>-update helper
+	UpdateURL string `json:",omitempty"`
+	//Capabilities are granted to the installed binary
+	Capabilities string `json:",omitempty"`
+	//Windows assets are kept apart from Assets, which shell
+	//scripts install, for scoop manifests and powershell scripts
+	Windows Assets `json:",omitempty"`
+	//Prefetch numbers programs downloaded before any installs
+	Prefetch int    `json:"-"`
+	cache    string // hit, stale or miss
+}
+
+// validate ensures the query contains nothing
+// which could be interpreted by a shell
+func (q Query) validate() error {
+	if !safeNameRe.MatchString(q.User) {
+		return errors.New("unsafe user")
+	}
+	if !safeNameRe.MatchString(q.Program) {
+		return errors.New("unsafe repo")
+	}
+	if q.Token != "" && !safeTokenRe.MatchString(q.Token) {
+		return errors.New("unsafe token")
+	}
+	if q.AsProgram != "" && !safeNameRe.MatchString(q.AsProgram) {
+		return errors.New("unsafe program name")
+	}
+	if q.Release != "" && !safeReleaseRe.MatchString(q.Release) {
+		return errors.New("unsafe release")
+	}
+	if q.Sudo != "" && q.Sudo != "never" && q.Sudo != "auto" && q.Sudo != "always" {
+		return errors.New("unknown sudo mode")
+	}
+	if q.Proxy != "" && !safeProxyRe.MatchString(q.Proxy) {
+		return errors.New("unsafe proxy")
+	}
+	if q.Versions != "" && q.Versions != "keep" {
+		return errors.New("unknown versions mode")
+	}
+	if q.Verify != "" && q.Verify != "codesign" && q.Verify != "codesign-warn" {
+		return errors.New("unknown verify mode")
+	}
+	if q.Versions != "" && q.Versioned {
+		return errors.New("versioned and versions cannot be combined")
+	}
+	if q.Dir != "" && (!safeDirRe.MatchString(q.Dir) || strings.Contains("/"+q.Dir+"/", "/../")) {
+		return errors.New("unsafe directory")
+	}
+	return nil
+}
+
+// validate ensures every value rendered into
+// scripts contains no shell meta characters
+func (r Result) validate() error {
+	if err := r.Query.validate(); err != nil {
+		return err
+	}
+	if r.VersionCommand != "" && !safeArgsRe.MatchString(r.VersionCommand) {
+		return errors.New("unsafe version command")
+	}
+	if r.CompletionCommand != "" && !safeArgsRe.MatchString(strings.ReplaceAll(r.CompletionCommand, "{shell}", "shell")) {
+		return errors.New("unsafe completion command")
+	}
+	for _, f := range r.Files {
+		pattern, dest := splitHalf(f, "=")
+		if !safeGlobRe.MatchString(pattern) || !safeDirRe.MatchString(dest) || strings.Contains("/"+dest+"/", "/../") {
+			return fmt.Errorf("unsafe file rule: %q", f)
+		}
+	}
+	if r.UpdateURL != "" && !safeUpdateRe.MatchString(r.UpdateURL) {
+		return errors.New("unsafe update url")
+	}
+	if r.Capabilities != "" && !safeCapsRe.MatchString(r.Capabilities) {
+		return errors.New("unsafe capabilities")
+	}
+	for _, as := range []Assets{r.Assets, r.Windows} {
+		for _, a := range as {
+			if err := a.validate(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
 }
 
 func (q Query) cacheKey() string {
@@ -49,30 +169,202 @@ func (q Query) cacheKey() string {
 	if err := jw.Encode(q); err != nil {
 		panic(err)
 	}
+	//results fetched with a client token are private to that token
+	hw.Write([]byte(q.Token))
 	return base64.StdEncoding.EncodeToString(hw.Sum(nil))
 }
 
 // Handler serves install scripts using Github releases
 type Handler struct {
 	Config
-	cacheMut sync.Mutex
-	cache    map[string]Result
+	//Audit receives an entry for each served script,
+	//defaults to Config.AuditLog when set
+	Audit AuditSink
+	//Reporter receives unexpected failures, defaults
+	//to Config.SentryDSN and Config.ErrorWebhook when set
+	Reporter ErrorReporter
+	//Level, when set, is adjusted by /admin/loglevel
+	//and by reloading Config.LogLevel
+	Level *slog.LevelVar
+	//Cache stores resolved releases, defaults to memory
+	Cache Cache
+	//Prefix is the path the handler is mounted under
+	//(e.g. /install), stripped from requests
+	Prefix string
+	//AssetFilters, PostProcessors and AuthCheckers let
+	//downstream code extend the handler, run in order
+	AssetFilters   []AssetFilter
+	PostProcessors []PostProcessor
+	AuthCheckers   []AuthChecker
+	levelMut       sync.Mutex
+	levelTimer     *time.Timer
+	levelPrev      slog.Level
+	//held while serving, Reload waits for requests in flight
+	configMut  sync.RWMutex
+	clientMut  sync.Mutex
+	httpClient *http.Client
+	guard      *guard
+	initOnce   sync.Once
+	//request rate limits
+	ipLimiter   *limiter
+	repoLimiter *limiter
+	quotas      quotas
+	aliases     aliases
+	auditSalt   string
+	signer      *signer
+	oidc        *oidcVerifier
+	accessLog   *accessLog
+	started     time.Time
+	//github rate limit backoff
+	limitMut     sync.Mutex
+	limitedUntil time.Time
+	quota        RateLimit
+	quotaAlerted bool
+	//consecutive failed github requests
+	upstreamFails atomic.Int32
+	stats         stats
+	latency       latencies
+	selfTest      selfTest
+	searches      searches
+	tap           gitRepo
+	bucket        gitRepo
+	//readiness probe results
+	readyMut     sync.Mutex
+	readyChecked time.Time
+	readyErr     error
+}
+
+func (h *Handler) init() {
+	h.started = time.Now()
+	if h.Cache == nil && h.Config.CacheDir != "" {
+		h.Cache = NewDirCache(h.Config.CacheDir)
+	}
+	if h.Cache == nil {
+		h.Cache = NewMemoryCache()
+	}
+	h.auditSalt = h.Config.AuditSalt
+	if h.auditSalt == "" {
+		h.auditSalt = randomSalt()
+	}
+	h.configure()
+	if h.Config.StatsFile != "" {
+		if err := h.stats.load(h.Config.StatsFile); err != nil {
+			slog.Warn("loading stats failed", "err", err)
+		}
+		go h.persistStats(h.Config.StatsFile)
+	}
+	if h.Config.ConfigFile != "" {
+		go h.watchConfig(h.Config.ConfigFile)
+	}
+	if h.Config.SelfTestRepo != "" {
+		go h.runSelfTests(h.Config.SelfTestRepo, h.Config.SelfTestInterval)
+	}
+	if h.Config.AccessLog != "" {
+		a, err := openAccessLog(h.Config.AccessLog, h.Config.AccessLogFormat)
+		if err != nil {
+			slog.Warn("access log disabled", "err", err)
+		} else {
+			h.accessLog = a
+		}
+	}
+	if h.Reporter == nil {
+		rs := reporters{}
+		if h.Config.SentryDSN != "" {
+			if s, err := newSentryReporter(h.Config.SentryDSN, h); err != nil {
+				slog.Warn("sentry disabled", "err", err)
+			} else {
+				rs = append(rs, s)
+			}
+		}
+		if h.Config.ErrorWebhook != "" {
+			rs = append(rs, &webhookReporter{url: h.Config.ErrorWebhook, h: h})
+		}
+		if len(rs) > 0 {
+			h.Reporter = rs
+		}
+	}
+	if h.Audit == nil && h.Config.AuditLog != "" {
+		a, err := openAudit(h.Config.AuditLog)
+		if err != nil {
+			slog.Warn("audit log disabled", "err", err)
+		} else {
+			h.Audit = a
+		}
+	}
+}
+
+// configure derives state from settings which may be reloaded
+func (h *Handler) configure() {
+	h.resetClient()
+	h.ipLimiter = newLimiter(h.Config.RateLimit, time.Minute)
+	h.repoLimiter = newLimiter(h.Config.RepoLimit, time.Minute)
+	h.quotas = newQuotas(SplitList(h.Config.OrgQuotas))
+	h.aliases = newAliases(SplitList(h.Config.Aliases))
+	h.signer = nil
+	if h.Config.SigningKey != "" {
+		s, err := newSigner(h.Config.SigningKey)
+		if err != nil {
+			slog.Warn("script signing disabled", "err", err)
+		} else {
+			h.signer = s
+		}
+	}
+	h.oidc = nil
+	//issuers such as google sign tokens for anyone
+	if h.Config.OIDCIssuer != "" && len(SplitList(h.Config.OIDCSubjects)) == 0 {
+		slog.Error("oidc admin disabled, it requires OIDC_SUBJECTS")
+	} else if h.Config.OIDCIssuer != "" {
+		h.oidc = &oidcVerifier{
+			issuer:   h.Config.OIDCIssuer,
+			audience: h.Config.OIDCAudience,
+			h:        h,
+		}
+	}
 }
 
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.Prefix != "" {
+		http.StripPrefix(strings.TrimSuffix(h.Prefix, "/"), http.HandlerFunc(h.serve)).ServeHTTP(w, r)
+		return
+	}
+	h.serve(w, r)
+}
+
+func (h *Handler) serve(w http.ResponseWriter, r *http.Request) {
+	h.configMut.RLock()
+	defer h.configMut.RUnlock()
+	h.securityHeaders(w)
 	if r.URL.Path == "/healthz" {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("OK"))
 		return
 	}
+	h.initOnce.Do(h.init)
+	if r.URL.Path == "/readyz" {
+		h.serveReady(w, r)
+		return
+	}
+	if r.URL.Path == "/version" {
+		h.serveVersion(w, r)
+		return
+	}
+	if h.serveWellKnown(w, r) {
+		return
+	}
+	r, reqID := withRequestID(w, r)
+	lw := &logWriter{ResponseWriter: w}
+	lw.attrs = append(lw.attrs, slog.String("request_id", reqID))
+	start := time.Now()
+	defer h.logRequest(lw, r, start)
+	w = lw
 	// calculate response type
 	ext := ""
-	script := ""
+	tmpl := ""
 	qtype := r.URL.Query().Get("type")
 	if qtype == "" {
 		ua := r.Header.Get("User-Agent")
 		switch {
-		case isTermRe.MatchString(ua):
+		case isTermRe.MatchString(ua), isBusyBoxRe.MatchString(ua), isPwshRe.MatchString(ua):
 			qtype = "script"
 		case isHomebrewRe.MatchString(ua):
 			qtype = "ruby"
@@ -80,30 +372,153 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			qtype = "text"
 		}
 	}
+	// urls only, to be fetched elsewhere
+	if r.URL.Query().Get("offline") == "1" {
+		qtype = "offline"
+	}
 	// type specific error response
 	showError := func(msg string, code int) {
-		// prevent shell injection
-		cleaned := errMsgRe.ReplaceAllString(msg, "")
-		if qtype == "script" {
-			cleaned = fmt.Sprintf("echo '%s'", cleaned)
+		lw.attrs = append(lw.attrs, slog.String("error", msg))
+		h.stats.error(requestError{Time: time.Now(), Path: r.URL.Path, Status: code, Error: msg, RequestID: reqID})
+		suggestions := []string{}
+		if code == http.StatusNotFound {
+			program := requestedProgram(r.URL.Path)
+			suggestions = h.aliases.suggest(program)
+			// other repos are never served when forced
+			if t := h.tenant(r); len(suggestions) == 0 && t.ForceUser == "" && t.ForceRepo == "" {
+				suggestions = h.searchSuggestions(r.Context(), program)
+			}
 		}
-		http.Error(w, cleaned, http.StatusInternalServerError)
+		if qtype == "json" {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("X-Content-Type-Options", "nosniff")
+			w.WriteHeader(code)
+			v := map[string]interface{}{"error": msg, "request_id": reqID}
+			if len(suggestions) > 0 {
+				v["suggestions"] = suggestions
+			}
+			json.NewEncoder(w).Encode(v)
+			return
+		}
+		// prevent shell injection, users may quote
+		// the request id in bug reports
+		h.writeError(w, r, qtype, errorPage{
+			Status:      code,
+			Message:     errMsgRe.ReplaceAllString(msg, ""),
+			RequestID:   reqID,
+			Home:        h.tenant(r).Home,
+			Suggestions: suggestions,
+		})
+	}
+	// recover from panics with a type specific error
+	defer func() {
+		p := recover()
+		if p == nil {
+			return
+		} else if p == http.ErrAbortHandler {
+			panic(p)
+		}
+		slog.Error("panic serving request", "err", p, "request_id", reqID, "stack", string(debug.Stack()))
+		h.report(r.Context(), ErrorReport{Kind: "panic", Message: fmt.Sprint(p), Path: r.URL.Path})
+		//too late once the response has started
+		if lw.status == 0 {
+			showError("Internal server error", http.StatusInternalServerError)
+		}
+	}()
+	if r.URL.Path == "/admin" || strings.HasPrefix(r.URL.Path, "/admin/") {
+		h.serveAdmin(w, r)
+		return
+	}
+	if (r.URL.Path == tapPath || strings.HasPrefix(r.URL.Path, tapPath+"/")) && len(SplitList(h.Config.TapRepos)) > 0 {
+		h.serveTap(w, r)
+		return
+	}
+	if (r.URL.Path == bucketPath || strings.HasPrefix(r.URL.Path, bucketPath+"/")) && len(SplitList(h.Config.ScoopRepos)) > 0 {
+		h.serveBucket(w, r)
+		return
+	}
+	if r.URL.Path == "/minisign.pub" && h.signer != nil {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(h.signer.publicKey()))
+		return
 	}
 	switch qtype {
 	case "script":
 		w.Header().Set("Content-Type", "text/x-shellscript")
 		ext = "sh"
-		script = string(scripts.Shell)
+		tmpl = "script"
+		// minimal containers often lack bash
+		switch r.URL.Query().Get("shell") {
+		case "posix", "sh":
+			tmpl = "posix"
+		case "powershell", "pwsh":
+			tmpl = "powershell"
+		case "bash":
+		case "":
+			if isBusyBoxRe.MatchString(r.UserAgent()) {
+				tmpl = "posix"
+			} else if isPwshRe.MatchString(r.UserAgent()) {
+				tmpl = "powershell"
+			}
+		default:
+			showError("Unknown shell, expected bash, posix or powershell", http.StatusBadRequest)
+			return
+		}
+		if tmpl == "powershell" {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			ext = "ps1"
+		}
+	case "uninstall":
+		w.Header().Set("Content-Type", "text/x-shellscript")
+		ext = "sh"
+		tmpl = "uninstall"
 	case "homebrew", "ruby":
 		w.Header().Set("Content-Type", "text/ruby")
 		ext = "rb"
-		script = string(scripts.Homebrew)
+		tmpl = "homebrew"
 	case "text":
 		w.Header().Set("Content-Type", "text/plain")
 		ext = "txt"
-		script = string(scripts.Text)
+		tmpl = "text"
+	case "offline":
+		w.Header().Set("Content-Type", "text/plain")
+		ext = "txt"
+		tmpl = "offline"
+	case "json":
+		//browser frontends consume results directly
+		if h.cors(w, r) {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		ext = "json"
 	default:
-		showError("Unknown type", http.StatusInternalServerError)
+		showError("Unknown type", http.StatusBadRequest)
+		return
+	}
+	// optional api key
+	if keys := SplitList(h.Config.APIKeys); len(keys) > 0 && !validKey(keys, r) {
+		showError("Missing or invalid API key", http.StatusUnauthorized)
+		return
+	}
+	// per client rate limit
+	if ok, wait := h.ipLimiter.allow(h.limitKey(r)); !ok {
+		w.Header().Set("Retry-After", retryAfter(wait))
+		showError("Too many requests, please slow down", http.StatusTooManyRequests)
+		return
+	}
+	// install statistics
+	switch r.URL.Path {
+	case "/stats":
+		h.serveStats(w, r)
+		return
+	case "/stats/errors":
+		h.serveHealthReport(w, r)
+		return
+	case "/stats/platforms":
+		h.servePlatforms(w, r)
+		return
+	case "/metrics":
+		h.serveMetrics(w, r)
 		return
 	}
 	q := Query{
@@ -112,72 +527,539 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		Release:   "",
 		Insecure:  r.URL.Query().Get("insecure") == "1",
 		AsProgram: r.URL.Query().Get("as"),
+		Dir:       r.URL.Query().Get("dir"),
+		Sudo:      r.URL.Query().Get("sudo"),
+		Versioned: r.URL.Query().Get("versioned") == "1",
+		Versions:  r.URL.Query().Get("versions"),
+		Debug:     r.URL.Query().Get("debug") == "1",
+		Quiet:     r.URL.Query().Get("quiet") == "1",
+		DryRun:    r.URL.Query().Get("dryrun") == "1",
+		Proxy:     r.URL.Query().Get("proxy"),
+		AddPath:   r.URL.Query().Get("addpath") == "1",
+		Force:     r.URL.Query().Get("force") == "1",
+		Upgrade:   r.URL.Query().Get("upgrade") == "1",
+		Helper:    r.URL.Query().Get("helper") == "1",
+		Man:       r.URL.Query().Get("man") == "1",
+		Verify:    r.URL.Query().Get("verify"),
+		//the program generates its own completions
+		Completions: r.URL.Query().Get("completions") == "1",
+		//server may also require checksums
+		RequireChecksum: r.URL.Query().Get("require_checksum") == "1" || h.Config.RequireChecksums,
+		Unpopular:       r.URL.Query().Get("unpopular") == "1",
+	}
+	// asset-like names are installed by their plain name
+	if q.AsProgram != "" {
+		q.AsProgram = normalizeName(q.AsProgram)
+	}
+	// client supplied github token
+	if h.Config.Passthrough {
+		q.Token = clientToken(r)
+	}
+	if q.Insecure && h.Config.HTTPSOnly {
+		showError("Insecure downloads are disabled on this server", http.StatusBadRequest)
+		return
+	}
+	mirror, err := h.mirror(r.URL.Query().Get("mirror"))
+	if err != nil {
+		showError("Mirror is not allowed on this server", http.StatusBadRequest)
+		return
 	}
 	// set query from route
 	path := strings.TrimPrefix(r.URL.Path, "/")
-	// move to path with !
-	if strings.HasSuffix(path, "!") {
+	// detached signature of the script with .sig
+	sign := false
+	if strings.HasSuffix(path, ".sig") {
+		if h.signer == nil {
+			showError("Script signing is not enabled on this server", http.StatusNotFound)
+			return
+		}
+		sign = true
+		path = strings.TrimSuffix(path, ".sig")
+	}
+	// move to path with !, always using sudo with !!,
+	// or into ~/.local/bin with !~
+	suffix := path[len(strings.TrimRight(path, "!~")):]
+	path = strings.TrimSuffix(path, suffix)
+	switch suffix {
+	case "":
+	case "!":
+		q.MoveToPath = true
+	case "!!":
+		q.MoveToPath = true
+		if q.Sudo == "" {
+			q.Sudo = "always"
+		}
+	case "!~":
+		if q.Dir == "" {
+			q.Dir = "~/.local/bin"
+		}
+	default:
+		showError("Unknown path suffix "+suffix, http.StatusBadRequest)
+		return
+	}
+	// or explicitly, overriding !
+	switch r.URL.Query().Get("move") {
+	case "1":
 		q.MoveToPath = true
-		path = strings.TrimRight(path, "!")
+	case "0":
+		q.MoveToPath = false
+	}
+	// kept versions are linked from ~/.local/bin by default
+	if q.Versions == "keep" && q.Dir == "" && !q.MoveToPath {
+		q.Dir = "~/.local/bin"
+	}
+	// repo from the subdomain, the path may only pin a release
+	if target, ok := h.subdomain(r); ok {
+		if path != "" && !strings.HasPrefix(path, "@") {
+			showError("Not found", http.StatusNotFound)
+			return
+		}
+		path = target + path
+	}
+	// one or more comma separated programs
+	targets := strings.Split(path, ",")
+	if len(targets) > 1 {
+		if len(targets) > maxPrograms {
+			showError(fmt.Sprintf("At most %d programs may be installed at once", maxPrograms), http.StatusBadRequest)
+			return
+		}
+		if qtype == "ruby" || qtype == "homebrew" {
+			showError("Multiple programs are not supported by Homebrew", http.StatusBadRequest)
+			return
+		}
+		if q.AsProgram != "" {
+			showError("Multiple programs cannot be installed as one", http.StatusBadRequest)
+			return
+		}
+	}
+	tenant := h.tenant(r)
+	if repo, _ := force(tenant.ForceRepo); path == "" && repo == "" {
+		http.Redirect(w, r, tenant.Home, http.StatusMovedPermanently)
+		return
+	}
+	queries := []Query{}
+	for _, target := range targets {
+		q := h.route(q, target, tenant)
+		// validate query
+		if q.User == "" {
+			slog.Debug("invalid path", "path", path)
+			showError("Invalid path", http.StatusBadRequest)
+			return
+		}
+		if err := q.validate(); err != nil {
+			slog.Debug("invalid query", "err", err)
+			showError("Invalid path: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !tenant.permits(q) {
+			showError("Forbidden: "+q.User+"/"+q.Program+" is not served here", http.StatusForbidden)
+			return
+		}
+		if code, err := h.checkAuth(r, q); err != nil {
+			showError(err.Error(), code)
+			return
+		}
+		queries = append(queries, q)
+	}
+	repos := make([]string, len(queries))
+	for i, q := range queries {
+		repos[i] = q.User + "/" + q.Program
+	}
+	traceQuery(r, queries[0], qtype)
+	lw.attrs = append(lw.attrs, slog.String("repo", strings.Join(repos, ",")), slog.String("type", qtype))
+	// fetch assets, abandoned once the client goes away
+	ctx := r.Context()
+	if h.Config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.Config.Timeout)
+		defer cancel()
+	}
+	results := []Result{}
+	cache := ""
+	defer func() {
+		if cache != "" {
+			h.latency.request.observe(cache, time.Since(start))
+		}
+	}()
+	for _, q := range queries {
+		// per repo rate limit
+		if ok, wait := h.repoLimiter.allow(strings.ToLower(q.User + "/" + q.Program)); !ok {
+			w.Header().Set("Retry-After", retryAfter(wait))
+			showError("Too many requests for this repo, please slow down", http.StatusTooManyRequests)
+			return
+		}
+		// per org install quota, head requests install nothing
+		if r.Method != http.MethodHead {
+			if ok, wait := h.quotas.allow(q.User); !ok {
+				w.Header().Set("Retry-After", retryAfter(wait))
+				showError("Hourly install quota exceeded for "+q.User+", please try again later", http.StatusTooManyRequests)
+				return
+			}
+		}
+		t0 := time.Now()
+		result, err := h.execute(ctx, q)
+		h.stats.resolved(q.User+"/"+q.Program, err)
+		if err != nil {
+			h.latency.resolve.observe("error", time.Since(t0))
+			showError(err.Error(), errorStatus(err))
+			return
+		}
+		h.latency.resolve.observe(result.cache, time.Since(t0))
+		// the slowest resolution determines the request
+		if cache == "" || result.cache == "miss" {
+			cache = result.cache
+		}
+		h.stats.request(result.User + "/" + result.Program)
+		// windows assets are never served, so dont count those clients
+		if p, _ := clientPlatform(r); qtype != "json" && (p == "linux" || p == "darwin") && !result.Assets.HasOS(p) {
+			h.stats.missing(q.User+"/"+q.Program, p)
+		}
+		// powershell scripts install the windows assets
+		if tmpl == "powershell" {
+			result.Assets, result.Windows = result.Windows, nil
+		}
+		result.Assets = result.Assets.mirrored(mirror)
+		result, err = h.finish(result)
+		if err != nil {
+			showError(err.Error(), errorStatus(err))
+			return
+		}
+		if q.Helper {
+			result.UpdateURL = h.updateURL(r, result.Query)
+		}
+		// last line of defence against script injection
+		if err := result.validate(); err != nil {
+			slog.Warn("refusing to render unsafe release", "repo", q.User+"/"+q.Program, "err", err)
+			showError("Refusing to render unsafe release: "+err.Error(), http.StatusBadGateway)
+			return
+		}
+		result.Home = tenant.Home
+		result.Banner = bannerLines(tenant.Banner)
+		results = append(results, result)
+	}
+	// server side problems, kept out of the body so
+	// pinned and signed scripts stay byte for byte the same
+	if warning := h.quotaWarning(); warning != "" {
+		w.Header().Set("X-Installer-Warning", warning)
 	}
+	versions := make([]string, len(results))
+	for i, result := range results {
+		versions[i] = result.Release
+	}
+	lw.attrs = append(lw.attrs, slog.String("version", strings.Join(versions, ",")))
+	// unexpected failures are reported
+	renderError := func(msg string) {
+		h.report(r.Context(), ErrorReport{Kind: "template", Message: msg, Path: r.URL.Path, Repo: strings.Join(repos, ","), Type: qtype})
+		showError(msg, http.StatusInternalServerError)
+	}
+	buff := bytes.Buffer{}
+	t0 := time.Now()
+	if qtype == "json" {
+		enc := json.NewEncoder(&buff)
+		enc.SetIndent("", "  ")
+		var v interface{} = results
+		if len(results) == 1 {
+			v = results[0]
+		}
+		if err := enc.Encode(v); err != nil {
+			renderError("installer BUG: " + err.Error())
+			return
+		}
+	} else {
+		// load templates
+		ts, err := h.templates()
+		if err != nil {
+			renderError("Template error: " + err.Error())
+			return
+		}
+		// execute template
+		t := ts.Lookup(tmpl)
+		if len(results) == 1 {
+			err = t.Execute(&buff, results[0])
+		} else {
+			err = renderAll(&buff, t, results, qtype)
+		}
+		if err != nil {
+			renderError("Template error: " + err.Error())
+			return
+		}
+	}
+	h.latency.render.observe(qtype, time.Since(t0))
+	// downstream post processing
+	format := tmpl
+	if qtype == "json" {
+		format = "json"
+	}
+	body, err := h.postProcess(format, results, buff.Bytes())
+	if err != nil {
+		renderError("Post processing error: " + err.Error())
+		return
+	}
+	// pinned scripts
+	sum := sha256.Sum256(body)
+	hash := hex.EncodeToString(sum[:])
+	if expect := r.URL.Query().Get("expect_sha256"); expect != "" && !strings.EqualFold(expect, hash) {
+		slog.Warn("script hash mismatch", "repo", strings.Join(repos, ","), "release", strings.Join(versions, ","), "expected", expect, "got", hash)
+		showError("Script does not match expected sha256 "+expect, http.StatusConflict)
+		return
+	}
+	w.Header().Set("X-Script-SHA256", hash)
+	etag := hash
+	if sign {
+		name := "install." + ext
+		if len(results) == 1 {
+			name = fmt.Sprintf("%s_%s.%s", results[0].Program, results[0].Release, ext)
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		body = h.signer.sign(body, name)
+		sum := sha256.Sum256(body)
+		etag = hex.EncodeToString(sum[:])
+	}
+	// conditional and header only requests
+	w.Header().Set("ETag", `"`+etag+`"`)
+	if etagMatch(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	if r.Method == http.MethodHead {
+		return
+	}
+	// ready
+	w.Write(body)
+	if sign {
+		return
+	}
+	for _, result := range results {
+		h.audit(r, result, qtype)
+		if qtype != "json" && qtype != "uninstall" && qtype != "offline" {
+			goos, arch := clientPlatform(r)
+			h.stats.install(installKey{
+				Repo:     result.User + "/" + result.Program,
+				Version:  result.Release,
+				Platform: goos,
+			})
+			h.stats.platform(goos, arch)
+		}
+	}
+}
+
+// route sets the user, program and release of q from
+// a single user/repo@release path target
+func (h *Handler) route(q Query, target string, t Tenant) Query {
 	var rest string
-	q.User, rest = splitHalf(path, "/")
+	q.User, rest = splitHalf(target, "/")
 	q.Program, q.Release = splitHalf(rest, "@")
 	// no program? treat first part as program, use default user
 	if q.Program == "" {
 		q.Program = q.User
-		q.User = h.Config.User
+		q.User = t.User
 		q.Google = true
+		// configured short names
+		name, release := splitHalf(q.Program, "@")
+		if user, program, ok := h.aliases.lookup(name); ok {
+			q.User, q.Program, q.Release = user, program, release
+			q.Google = false
+		}
 	}
 	// micro > nano!
 	if q.User == "" && q.Program == "micro" {
 		q.User = "zyedidia"
 	}
 	// force user/repo
-	if h.Config.ForceUser != "" {
-		q.User = h.Config.ForceUser
+	if user, _ := force(t.ForceUser); user != "" {
+		q.User = user
 	}
-	if h.Config.ForceRepo != "" {
-		q.Program = h.Config.ForceRepo
+	if repo, _ := force(t.ForceRepo); repo != "" {
+		q.Program = repo
 	}
-	// validate query
-	valid := q.User != ""
-	if !valid && path == "" {
-		http.Redirect(w, r, "https://github.com/jpillora/installer", http.StatusMovedPermanently)
-		return
+	return q
+}
+
+// finish applies asset filters, server policy and repo
+// overrides to a resolved release
+func (h *Handler) finish(result Result) (Result, error) {
+	// windows only releases
+	if len(result.Assets) == 0 {
+		return result, fmt.Errorf("downloads for this release %w", errNotFound)
 	}
-	if !valid {
-		log.Printf("invalid path: query: %#v", q)
-		showError("Invalid path", http.StatusBadRequest)
-		return
+	result, err := h.filterAssets(result)
+	if err != nil {
+		return result, err
+	}
+	if result.Assets, err = h.policy(result.Assets, result.RequireChecksum); err != nil {
+		return result, err
+	}
+	o := h.override(result.User, result.Program)
+	result.VersionCommand = o.VersionCommand
+	result.Files = o.Files
+	result.Capabilities = o.Capabilities
+	if result.Completions {
+		result.CompletionCommand = o.CompletionCommand
+	}
+	return result, nil
+}
+
+// policy refuses plain http downloads when configured, and drops
+// assets without checksums when required
+func (h *Handler) policy(assets Assets, requireChecksum bool) (Assets, error) {
+	// never hand out plain http downloads
+	if h.Config.HTTPSOnly {
+		for _, a := range assets {
+			if !strings.HasPrefix(a.URL, "https://") {
+				return nil, errors.New("Asset " + a.Name + " is not served over https")
+			}
+		}
+	}
+	// only hand out verifiable downloads
+	if requireChecksum {
+		verified := Assets{}
+		for _, a := range assets {
+			if a.SHA256 != "" {
+				verified = append(verified, a)
+			}
+		}
+		if len(verified) == 0 {
+			return nil, errors.New("No assets with checksums found for this release")
+		}
+		assets = verified
 	}
-	// fetch assets
-	result, err := h.execute(q)
+	return assets, nil
+}
+
+// Resolve finds the release assets which a script for q would
+// download, so Go programs can reuse the asset selection without
+// serving HTTP. Unlike requests, q is used as is, without aliases
+// or a default user.
+func (h *Handler) Resolve(ctx context.Context, q Query) (Result, error) {
+	h.configMut.RLock()
+	defer h.configMut.RUnlock()
+	h.initOnce.Do(h.init)
+	q.RequireChecksum = q.RequireChecksum || h.Config.RequireChecksums
+	if err := q.validate(); err != nil {
+		return Result{}, err
+	}
+	result, err := h.execute(ctx, q)
 	if err != nil {
-		showError(err.Error(), http.StatusBadGateway)
-		return
+		return Result{}, err
+	}
+	if result, err = h.finish(result); err != nil {
+		return Result{}, err
+	}
+	if err := result.validate(); err != nil {
+		return Result{}, fmt.Errorf("unsafe release: %w", err)
+	}
+	return result, nil
+}
+
+// Render writes the named template (script, posix, homebrew, text,
+// uninstall or offline) for result, e.g. so a reviewed script can be
+// vendored rather than fetched at install time
+func (h *Handler) Render(w io.Writer, result Result, name string) error {
+	if err := result.validate(); err != nil {
+		return fmt.Errorf("unsafe release: %w", err)
 	}
-	// load template
-	t, err := template.New("installer").Parse(script)
+	ts, err := h.templates()
 	if err != nil {
-		showError("installer BUG: "+err.Error(), http.StatusInternalServerError)
-		return
+		return err
+	}
+	t := ts.Lookup(name)
+	if t == nil || strings.HasPrefix(name, "error-") {
+		return fmt.Errorf("unknown template %q", name)
 	}
-	// execute template
 	buff := bytes.Buffer{}
 	if err := t.Execute(&buff, result); err != nil {
-		showError("Template error: "+err.Error(), http.StatusInternalServerError)
-		return
+		return err
 	}
-	log.Printf("serving script %s/%s@%s (%s)", q.User, q.Program, q.Release, ext)
-	// ready
-	w.Write(buff.Bytes())
+	body, err := h.postProcess(name, []Result{result}, buff.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(body)
+	return err
+}
+
+// renderAll combines the output of each result, each
+// script runs in a subshell and stops the rest on failure
+func renderAll(w io.Writer, t *template.Template, results []Result, qtype string) error {
+	//powershell scripts stop at the first error by themselves
+	if t.Name() == "powershell" {
+		for i, result := range results {
+			if i > 0 {
+				result.Banner = nil
+			}
+			if err := t.Execute(w, result); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	script := qtype == "script" || qtype == "uninstall"
+	if t.Name() == "posix" || t.Name() == "uninstall" {
+		fmt.Fprintf(w, "#!/bin/sh\n")
+	} else if script {
+		fmt.Fprintf(w, "#!/bin/bash\n")
+	}
+	//download every program first, a few at a time, the
+	//installs which follow then only use verified downloads
+	if qtype == "script" && len(results) > 1 {
+		fmt.Fprintf(w, "PREFETCH_DIR=$(mktemp -d \"${TMPDIR:-/tmp}/jpillora-installer-XXXXXXXXXX\")\n")
+		fmt.Fprintf(w, "trap 'rm -rf \"$PREFETCH_DIR\"' EXIT\ntrap \"exit 130\" INT\ntrap \"exit 143\" TERM\n")
+		for i := range results {
+			results[i].Prefetch = i + 1
+			result := results[i]
+			result.Banner = nil
+			fmt.Fprintf(w, "(\nPREFETCHING=1\n")
+			if err := t.Execute(w, result); err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "\n) > /dev/null 2>&1 &\n")
+			if (i+1)%maxDownloads == 0 {
+				fmt.Fprintf(w, "wait\n")
+			}
+		}
+		fmt.Fprintf(w, "wait\n")
+	}
+	for i, result := range results {
+		if script {
+			fmt.Fprintf(w, "(\n")
+		} else if i > 0 {
+			fmt.Fprintf(w, "\n")
+		}
+		//only show the banner once
+		if i > 0 {
+			result.Banner = nil
+		}
+		if err := t.Execute(w, result); err != nil {
+			return err
+		}
+		if script {
+			fmt.Fprintf(w, "\n) || exit 1\n")
+		}
+	}
+	return nil
 }
 
 type Asset struct {
 	Name, OS, Arch, URL, Type, SHA256 string
 }
 
+func (a Asset) validate() error {
+	if !safeAssetRe.MatchString(a.Name) {
+		return fmt.Errorf("unsafe asset name: %q", a.Name)
+	}
+	if !safeURLRe.MatchString(a.URL) {
+		return fmt.Errorf("unsafe asset url: %q", a.URL)
+	}
+	if !safeNameRe.MatchString(a.OS) || !safeNameRe.MatchString(a.Arch) || !safeNameRe.MatchString(a.Type) {
+		return fmt.Errorf("unsafe asset platform: %q", a.Name)
+	}
+	if a.SHA256 != "" && !sha256Re.MatchString(a.SHA256) {
+		return fmt.Errorf("unsafe asset checksum: %q", a.Name)
+	}
+	return nil
+}
+
 func (a Asset) Key() string {
 	return a.OS + "/" + a.Arch
 }
@@ -196,6 +1078,27 @@ func (a Asset) IsMacM1() bool {
 
 type Assets []Asset
 
+func (as Assets) HasOS(os string) bool {
+	for _, a := range as {
+		if a.OS == os {
+			return true
+		}
+	}
+	return false
+}
+
+// split separates the assets of os from the rest
+func (as Assets) split(os string) (rest, matched Assets) {
+	for _, a := range as {
+		if a.OS == os {
+			matched = append(matched, a)
+		} else {
+			rest = append(rest, a)
+		}
+	}
+	return rest, matched
+}
+
 func (as Assets) HasM1() bool {
 	//detect if we have a native m1 asset
 	for _, a := range as {
@@ -206,27 +1109,138 @@ func (as Assets) HasM1() bool {
 	return false
 }
 
-func (h *Handler) get(url string, v interface{}) error {
-	req, _ := http.NewRequest("GET", url, nil)
+// htmlCSP replaces the default policy on html pages,
+// which need their inline styles
+const htmlCSP = "default-src 'none'; style-src 'unsafe-inline'; frame-ancestors 'none'"
+
+// securityHeaders are set on every response
+func (h *Handler) securityHeaders(w http.ResponseWriter) {
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if h.Config.CSP != "" {
+		w.Header().Set("Content-Security-Policy", h.Config.CSP)
+	}
+	if h.Config.ReferrerPolicy != "" {
+		w.Header().Set("Referrer-Policy", h.Config.ReferrerPolicy)
+	}
+}
+
+// errorStatus maps resolution errors onto http status codes
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, errNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, errRateLimited):
+		return http.StatusTooManyRequests
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusBadGateway
+}
+
+// etagMatch checks an If-None-Match header against an etag
+func etagMatch(header, etag string) bool {
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimPrefix(strings.TrimSpace(t), "W/")
+		if t == "*" || t == `"`+etag+`"` {
+			return true
+		}
+	}
+	return false
+}
+
+// validKey checks the request's api key against the allowed keys
+func validKey(keys []string, r *http.Request) bool {
+	key := r.Header.Get("X-API-Key")
+	if key == "" {
+		key = r.URL.Query().Get("key")
+	}
+	if key == "" {
+		return false
+	}
+	valid := false
+	for _, k := range keys {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			valid = true
+		}
+	}
+	return valid
+}
+
+// clientToken extracts a github token from the Authorization
+// header, falling back to the ?token= query parameter
+func clientToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		scheme, token := splitHalf(auth, " ")
+		if token == "" {
+			return scheme
+		}
+		if strings.EqualFold(scheme, "token") || strings.EqualFold(scheme, "bearer") {
+			return strings.TrimSpace(token)
+		}
+		return ""
+	}
+	if token := r.URL.Query().Get("token"); token != "" {
+		slog.Warn("github token supplied via ?token=, this may leak into logs and shell history, use the Authorization header instead")
+		return token
+	}
+	return ""
+}
+
+// token returns the github token to use for the given query,
+// preferring the client supplied token
+func (h *Handler) token(q Query) string {
+	if q.Token != "" {
+		return q.Token
+	}
+	return h.Config.Token
+}
+
+func (h *Handler) get(ctx context.Context, url, token string, v interface{}) error {
+	//dont hammer github while it has asked us to back off,
+	//client supplied tokens have their own quota
+	server := token == h.Config.Token
+	if wait := h.rateLimited(); server && wait > 0 {
+		return fmt.Errorf("%w: retry in %s", errRateLimited, wait.Round(time.Second))
+	}
+	req, _ := http.NewRequestWithContext(ctx, "GET", url, nil)
 	req.Header.Set("Accept", "application/vnd.github.v3+json")
-	if h.Config.Token != "" {
-		req.Header.Set("Authorization", "token "+h.Config.Token)
+	if token != "" {
+		req.Header.Set("Authorization", "token "+token)
 	}
-	resp, err := http.Get(url)
+	resp, err := h.do(req)
 	if err != nil {
+		h.upstreamResult(ctx, err)
 		return fmt.Errorf("request failed: %s: %s", url, err)
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		h.upstreamResult(ctx, errors.New(resp.Status))
+	} else {
+		h.upstreamResult(ctx, nil)
+	}
+	if server {
+		h.observeQuota(resp)
+	}
 
 	if resp.StatusCode == 404 {
 		return fmt.Errorf("%w: url %s", errNotFound, url)
 	}
 	if resp.StatusCode != 200 {
-		b, _ := io.ReadAll(resp.Body)
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorSize))
+		if wait, ok := rateLimitWait(resp, b); ok {
+			//one client's exhausted token must not stall everyone
+			if server {
+				slog.Warn("github rate limit hit, backing off", "wait", wait.Round(time.Second))
+				h.backoff(wait)
+			}
+			return fmt.Errorf("%w: retry in %s", errRateLimited, wait.Round(time.Second))
+		}
 		return errors.New(http.StatusText(resp.StatusCode) + " " + string(b))
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+	if err := decodeJSON(resp.Body, v); err != nil {
 		return fmt.Errorf("download failed: %s: %s", url, err)
 	}
 
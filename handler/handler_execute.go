@@ -2,144 +2,230 @@ package handler
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"net/http"
 	"strings"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func (h *Handler) execute(q Query) (Result, error) {
+func (h *Handler) execute(ctx context.Context, q Query) (_ Result, err error) {
+	ctx, span := tracer.Start(ctx, "resolve", trace.WithAttributes(
+		attribute.String("installer.repo", q.User+"/"+q.Program),
+		attribute.String("installer.release", q.Release),
+	))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+	if err := h.allowed(q); err != nil {
+		return Result{}, err
+	}
 	//load from cache
 	key := q.cacheKey()
-	h.cacheMut.Lock()
-	if h.cache == nil {
-		h.cache = map[string]Result{}
-	}
-	cached, ok := h.cache[key]
-	h.cacheMut.Unlock()
+	cached, ok := h.Cache.Get(key)
+	//client tokens are part of the key, but never stored
+	cached.Token = q.Token
 	//cache hit
-	if ok && time.Since(cached.Timestamp) < cacheTTL {
+	ttl := h.Config.CacheTTL
+	if ttl <= 0 {
+		ttl = cacheTTL
+	}
+	if ok && time.Since(cached.Timestamp) < ttl {
+		span.SetAttributes(attribute.String("installer.cache", "hit"))
+		cached.cache = "hit"
 		return cached, nil
 	}
+	//github asked us to back off, serve stale results meanwhile
+	if ok && h.token(q) == h.Config.Token && h.rateLimited() > 0 {
+		slog.Warn("rate limited, serving stale result", "repo", q.User+"/"+q.Program)
+		span.SetAttributes(attribute.String("installer.cache", "stale"))
+		cached.cache = "stale"
+		return cached, nil
+	}
+	span.SetAttributes(attribute.String("installer.cache", "miss"))
 	//do real operation
 	ts := time.Now()
-	release, assets, err := h.getAssetsNoCache(q)
+	release, private, assets, err := h.getAssetsNoCache(ctx, q)
 	if err == nil {
 		//didn't need google
 		q.Google = false
 	} else if errors.Is(err, errNotFound) && q.Google {
 		//use google to auto-detect user...
-		user, program, gerr := searchGoogle(q.Program)
+		user, program, gerr := h.searchGoogle(ctx, q.Program)
 		if gerr != nil {
-			log.Printf("google search failed: %s", gerr)
+			slog.Warn("google search failed", "err", gerr)
 		} else {
-			log.Printf("google search found: %s/%s", user, program)
+			slog.Info("google search found", "repo", user+"/"+program)
 			if program != q.Program {
-				log.Printf("program mismatch: got %s: expected %s", q.Program, program)
+				slog.Debug("program mismatch", "got", q.Program, "expected", program)
 			}
 			q.Program = program
 			q.User = user
 			//retry assets...
-			release, assets, err = h.getAssetsNoCache(q)
+			if err = h.allowed(q); err == nil {
+				release, private, assets, err = h.getAssetsNoCache(ctx, q)
+			}
 		}
 	}
 	//asset fetch failed, dont cache
 	if err != nil {
+		if ok && errors.Is(err, errRateLimited) {
+			slog.Warn("rate limited, serving stale result", "repo", q.User+"/"+q.Program)
+			span.SetAttributes(attribute.String("installer.cache", "stale"))
+			cached.cache = "stale"
+			return cached, nil
+		}
 		return Result{}, err
 	}
+	//tags are chosen by the repo owner, never trust them
+	if release != "" && !safeReleaseRe.MatchString(release) {
+		return Result{}, fmt.Errorf("release tag %q contains unsafe characters", release)
+	}
 	//success
 	if q.Release == "" && release != "" {
-		log.Printf("detected release: %s", release)
+		slog.Debug("detected release", "release", release)
 		q.Release = release
 	}
+	assets, windows := assets.split("windows")
 	result := Result{
 		Timestamp: ts,
 		Query:     q,
 		Assets:    assets,
+		Windows:   windows,
 		M1Asset:   assets.HasM1(),
+		Private:   private,
 	}
 	//success store results
-	h.cacheMut.Lock()
-	h.cache[key] = result
-	h.cacheMut.Unlock()
+	h.Cache.Set(key, result)
+	result.cache = "miss"
 	return result, nil
 }
 
-func (h *Handler) getAssetsNoCache(q Query) (string, Assets, error) {
+// allowed enforces the configured user allowlist and repo denylist
+func (h *Handler) allowed(q Query) error {
+	repo := q.User + "/" + q.Program
+	if allow := SplitList(h.Config.AllowUsers); len(allow) > 0 && !matchAny(allow, q.User) {
+		return fmt.Errorf("%w: %s is not allowed on this server", errForbidden, repo)
+	}
+	if matchAny(SplitList(h.Config.DenyRepos), repo) {
+		return fmt.Errorf("%w: %s is not allowed on this server", errForbidden, repo)
+	}
+	return nil
+}
+
+func (h *Handler) getAssetsNoCache(ctx context.Context, q Query) (string, bool, Assets, error) {
 	user := q.User
 	repo := q.Program
 	release := q.Release
 	//not cached - ask github
-	log.Printf("fetching asset info for %s/%s@%s", user, repo, release)
-	url := fmt.Sprintf("https://api.github.com/repos/%s/%s/releases", user, repo)
+	slog.Debug("fetching asset info", "repo", user+"/"+repo, "release", release)
+	url := fmt.Sprintf("%s/repos/%s/%s", h.apiURL(), user, repo)
+	token := h.token(q)
+	repoURL := url
+	private := false
+	guarded := (h.Config.MinStars > 0 || h.Config.MinRepoAge > 0) && !q.Unpopular
+	if guarded {
+		ghr := ghRepo{}
+		if err := h.get(ctx, repoURL, token, &ghr); err != nil {
+			return release, false, nil, err
+		}
+		private = ghr.Private
+		if err := h.popular(ghr); err != nil {
+			return release, false, nil, err
+		}
+	}
+	url += "/releases"
 	ghas := ghAssets{}
 	if release == "" {
 		url += "/latest"
 		ghr := ghRelease{}
-		if err := h.get(url, &ghr); err != nil {
-			return release, nil, err
+		if err := h.get(ctx, url, token, &ghr); err != nil {
+			return release, false, nil, err
 		}
 		release = ghr.TagName //discovered
 		ghas = ghr.Assets
 	} else {
 		ghrs := []ghRelease{}
-		if err := h.get(url, &ghrs); err != nil {
-			return release, nil, err
+		if err := h.get(ctx, url, token, &ghrs); err != nil {
+			return release, false, nil, err
 		}
 		found := false
 		for _, ghr := range ghrs {
 			if ghr.TagName == release {
 				found = true
-				if err := h.get(ghr.AssetsURL, &ghas); err != nil {
-					return release, nil, err
+				if err := h.get(ctx, h.mirrorURL(ghr.AssetsURL), token, &ghas); err != nil {
+					return release, false, nil, err
 				}
 				ghas = ghr.Assets
 				break
 			}
 		}
 		if !found {
-			return release, nil, fmt.Errorf("release tag '%s' not found", release)
+			return release, false, nil, fmt.Errorf("release tag '%s' %w", release, errNotFound)
 		}
 	}
 	if len(ghas) == 0 {
-		return release, nil, errors.New("no assets found")
+		return release, false, nil, fmt.Errorf("release assets %w", errNotFound)
 	}
-	sumIndex, _ := ghas.getSumIndex()
+	if len(ghas) > maxAssets {
+		slog.Warn("release has too many assets, only considering the first", "assets", len(ghas), "max", maxAssets)
+		ghas = ghas[:maxAssets]
+	}
+	//only authenticated requests can see private repos
+	if token != "" && !guarded {
+		p, err := h.private(ctx, repoURL, token, ghas[0])
+		if err != nil {
+			return release, false, nil, err
+		}
+		private = p
+	}
+	sumIndex, _ := h.getSumIndex(ctx, ghas, token, private)
 	if l := len(sumIndex); l > 0 {
-		log.Printf("fetched %d asset shasums", l)
+		slog.Debug("fetched asset shasums", "count", l)
 	}
 	assets := Assets{}
 	index := map[string]bool{}
 	for _, ga := range ghas {
 		url := ga.BrowserDownloadURL
-		//only binary containers are supported
+		//match
+		os := getOS(ga.Name)
+		arch := getArch(ga.Name)
+		//only binary containers are supported,
+		//and plain executables on windows
 		//TODO deb,rpm etc
 		fext := getFileExt(url)
 		if fext == "" && ga.Size > 1024*1024 {
 			fext = ".bin" // +1MB binary
 		}
-		if fext != ".bin" && fext != ".zip" && fext != ".gz" && fext != ".tar.gz" && fext != ".tgz" {
-			log.Printf("fetched asset has unsupported file type: %s (ext '%s')", ga.Name, fext)
+		if fext != ".bin" && fext != ".zip" && fext != ".gz" && fext != ".tar.gz" && fext != ".tgz" && (fext != ".exe" || os != "windows") {
+			slog.Debug("fetched asset has unsupported file type", "asset", ga.Name, "ext", fext)
 			continue
 		}
-		//match
-		os := getOS(ga.Name)
-		arch := getArch(ga.Name)
-		//windows not supported yet
+		//windows assets are only used by scoop manifests and powershell scripts
 		if os == "windows" {
-			log.Printf("fetched asset is for windows: %s", ga.Name)
-			//TODO: powershell
-			// EG: iwr https://deno.land/x/install/install.ps1 -useb | iex
-			continue
+			slog.Debug("fetched asset is for windows", "asset", ga.Name)
 		}
 		//unknown os, cant use
 		if os == "" {
-			log.Printf("fetched asset has unknown os: %s", ga.Name)
+			slog.Debug("fetched asset has unknown os", "asset", ga.Name)
 			continue
 		}
-		log.Printf("fetched asset: %s", ga.Name)
+		slog.Debug("fetched asset", "asset", ga.Name)
+		//private assets must be downloaded via the api
+		if private {
+			url = h.mirrorURL(ga.URL)
+		}
 		asset := Asset{
 			OS:     os,
 			Arch:   arch,
@@ -148,6 +234,14 @@ func (h *Handler) getAssetsNoCache(q Query) (string, Assets, error) {
 			Type:   fext,
 			SHA256: sumIndex[ga.Name],
 		}
+		if !sha256Re.MatchString(asset.SHA256) {
+			asset.SHA256 = ""
+		}
+		//skip anything we couldn't safely render
+		if err := asset.validate(); err != nil {
+			slog.Warn("fetched asset is unsafe", "err", err)
+			continue
+		}
 		//there can only be 1 file for each OS/Arch
 		if index[asset.Key()] {
 			continue
@@ -157,33 +251,80 @@ func (h *Handler) getAssetsNoCache(q Query) (string, Assets, error) {
 		assets = append(assets, asset)
 	}
 	if len(assets) == 0 {
-		return release, nil, errors.New("no downloads found for this release")
+		return release, false, nil, fmt.Errorf("downloads for this release %w", errNotFound)
 	}
-	return release, assets, nil
+	return release, private, assets, nil
+}
+
+// popular guards against typosquatting, where a lookalike of a
+// popular repo is usually new and has few stars
+func (h *Handler) popular(ghr ghRepo) error {
+	const override = "(set the query param unpopular to 1 to install anyway)"
+	if need := h.Config.MinStars; need > 0 && ghr.Stars < need {
+		return fmt.Errorf("%w: %s has %d stars, fewer than the %d required on this server %s",
+			errForbidden, ghr.FullName, ghr.Stars, need, override)
+	}
+	if age := h.Config.MinRepoAge; age > 0 && time.Since(ghr.CreatedAt) < age {
+		return fmt.Errorf("%w: %s was created %s, more recently than allowed on this server %s",
+			errForbidden, ghr.FullName, ghr.CreatedAt.Format("2006-01-02"), override)
+	}
+	return nil
 }
 
 type ghAssets []ghAsset
 
-func (as ghAssets) getSumIndex() (map[string]string, error) {
+// private reports whether the repo of an asset is private. Downloads
+// don't count against the api rate limit, so the repo is only looked
+// up when the asset can't be downloaded anonymously.
+func (h *Handler) private(ctx context.Context, repoURL, token string, ga ghAsset) (bool, error) {
+	url := mirrorDownload(ga.BrowserDownloadURL, strings.TrimRight(h.Config.AssetMirror, "/"))
+	req, _ := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if resp, err := h.do(req); err == nil {
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			return false, nil
+		}
+	}
+	ghr := ghRepo{}
+	if err := h.get(ctx, repoURL, token, &ghr); err != nil {
+		return false, err
+	}
+	return ghr.Private, nil
+}
+
+func (h *Handler) getSumIndex(ctx context.Context, as ghAssets, token string, private bool) (map[string]string, error) {
 	url := ""
 	for _, ga := range as {
 		//is checksum file?
 		if ga.IsChecksumFile() {
 			url = ga.BrowserDownloadURL
+			if private {
+				url = h.mirrorURL(ga.URL)
+			} else {
+				//where github.com is blocked, so is the server
+				url = mirrorDownload(url, strings.TrimRight(h.Config.AssetMirror, "/"))
+			}
 			break
 		}
 	}
 	if url == "" {
 		return nil, errors.New("no sum file found")
 	}
-	resp, err := http.DefaultClient.Get(url)
+	req, _ := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "token "+token)
+	}
+	if private {
+		req.Header.Set("Accept", "application/octet-stream")
+	}
+	resp, err := h.do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 	// take each line and insert into the index
 	index := map[string]string{}
-	s := bufio.NewScanner(resp.Body)
+	s := bufio.NewScanner(io.LimitReader(resp.Body, maxSumsSize))
 	for s.Scan() {
 		fs := strings.Fields(s.Text())
 		if len(fs) != 2 {
@@ -219,6 +360,13 @@ func (g ghAsset) IsChecksumFile() bool {
 	return checksumRe.MatchString(strings.ToLower(g.Name)) && g.Size < 64*1024 //maximum file size 64KB
 }
 
+type ghRepo struct {
+	FullName  string    `json:"full_name"`
+	Private   bool      `json:"private"`
+	Stars     int       `json:"stargazers_count"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
 type ghRelease struct {
 	Assets    []ghAsset `json:"assets"`
 	AssetsURL string    `json:"assets_url"`
@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// logWriter records the response for the request log
+type logWriter struct {
+	http.ResponseWriter
+	status int
+	size   int64
+	//request scoped fields, added as the request is resolved
+	attrs []slog.Attr
+}
+
+func (lw *logWriter) WriteHeader(code int) {
+	if lw.status == 0 {
+		lw.status = code
+	}
+	lw.ResponseWriter.WriteHeader(code)
+}
+
+func (lw *logWriter) Write(b []byte) (int, error) {
+	if lw.status == 0 {
+		lw.status = http.StatusOK
+	}
+	n, err := lw.ResponseWriter.Write(b)
+	lw.size += int64(n)
+	return n, err
+}
+
+func (lw *logWriter) Unwrap() http.ResponseWriter {
+	return lw.ResponseWriter
+}
+
+// logRequest writes a single structured line per request
+func (h *Handler) logRequest(lw *logWriter, r *http.Request, start time.Time) {
+	status := lw.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	attrs := []slog.Attr{
+		slog.String("method", r.Method),
+		slog.String("path", r.URL.Path),
+		slog.Int("status", status),
+		slog.Int64("size", lw.size),
+		slog.Duration("duration", time.Since(start)),
+	}
+	ip := ""
+	if !h.Config.Privacy {
+		ip = clientIP(r, h.Config.TrustProxy)
+		attrs = append(attrs, slog.String("ip", ip))
+	}
+	if h.accessLog != nil {
+		h.accessLog.log(r, ip, start, status, lw.size)
+	}
+	attrs = append(attrs, lw.attrs...)
+	level := slog.LevelInfo
+	if status >= 500 {
+		level = slog.LevelWarn
+	}
+	slog.LogAttrs(r.Context(), level, "request", attrs...)
+}
@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// serveMetrics writes counters in the prometheus text exposition format
+func (h *Handler) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	metric(w, "installer_installs_total", "counter", "Install scripts served per repo, version and client platform.")
+	for _, c := range h.stats.installCounts("") {
+		fmt.Fprintf(w, "installer_installs_total{repo=%s,version=%s,platform=%s} %d\n",
+			label(c.Repo), label(c.Version), label(c.Platform), c.Installs)
+	}
+	h.latency.request.write(w, "installer_request_duration_seconds", "cache",
+		"Time to serve resolved requests by cache state.")
+	h.latency.resolve.write(w, "installer_resolve_duration_seconds", "cache",
+		"Time to resolve releases by cache state (a miss is spent upstream).")
+	h.latency.render.write(w, "installer_render_duration_seconds", "type",
+		"Time to render responses by type.")
+	h.selfTest.writeMetrics(w)
+}
+
+var latencyBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30}
+
+type latencies struct {
+	request, resolve, render histogram
+}
+
+// histogram of durations, partitioned by a single label
+type histogram struct {
+	mut    sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	counts []int //per bucket, non-cumulative
+	count  int
+	sum    float64
+}
+
+func (hg *histogram) observe(value string, d time.Duration) {
+	hg.mut.Lock()
+	defer hg.mut.Unlock()
+	if hg.series == nil {
+		hg.series = map[string]*series{}
+	}
+	s, ok := hg.series[value]
+	if !ok {
+		s = &series{counts: make([]int, len(latencyBuckets))}
+		hg.series[value] = s
+	}
+	secs := d.Seconds()
+	for i, le := range latencyBuckets {
+		if secs <= le {
+			s.counts[i]++
+			break
+		}
+	}
+	s.count++
+	s.sum += secs
+}
+
+func (hg *histogram) write(w io.Writer, name, key, help string) {
+	hg.mut.Lock()
+	defer hg.mut.Unlock()
+	if len(hg.series) == 0 {
+		return
+	}
+	metric(w, name, "histogram", help)
+	values := make([]string, 0, len(hg.series))
+	for v := range hg.series {
+		values = append(values, v)
+	}
+	sort.Strings(values)
+	for _, v := range values {
+		s := hg.series[v]
+		l := key + "=" + label(v)
+		n := 0
+		for i, le := range latencyBuckets {
+			n += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket{%s,le=\"%g\"} %d\n", name, l, le, n)
+		}
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, l, s.count)
+		fmt.Fprintf(w, "%s_sum{%s} %g\n", name, l, s.sum)
+		fmt.Fprintf(w, "%s_count{%s} %d\n", name, l, s.count)
+	}
+}
+
+func metric(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// label quotes a prometheus label value
+func label(v string) string {
+	return `"` + labelEscaper.Replace(v) + `"`
+}
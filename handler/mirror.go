@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"errors"
+	"strings"
+)
+
+const githubDownloads = "https://github.com/"
+
+// mirror returns the base url assets are downloaded from, the
+// configured AssetMirror unless the client chose an allowed one
+func (h *Handler) mirror(choice string) (string, error) {
+	if choice == "" {
+		return strings.TrimRight(h.Config.AssetMirror, "/"), nil
+	}
+	choice = strings.TrimRight(choice, "/")
+	for _, m := range SplitList(h.Config.AllowedMirrors) {
+		if strings.TrimRight(m, "/") == choice {
+			return choice, nil
+		}
+	}
+	return "", errors.New("mirror not allowed")
+}
+
+// mirrored rewrites github download urls onto the mirror base,
+// leaving the cached assets untouched. Private release assets are
+// api urls, which follow APIURL instead.
+func (as Assets) mirrored(base string) Assets {
+	if base == "" {
+		return as
+	}
+	out := make(Assets, len(as))
+	for i, a := range as {
+		a.URL = mirrorDownload(a.URL, base)
+		out[i] = a
+	}
+	return out
+}
+
+// mirrorDownload rewrites a github download url onto the mirror base
+func mirrorDownload(u, base string) string {
+	if rest, ok := strings.CutPrefix(u, githubDownloads); ok && base != "" {
+		return base + "/" + rest
+	}
+	return u
+}
@@ -0,0 +1,221 @@
+package handler
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const jwksRefresh = time.Minute
+
+var errBadIDToken = errors.New("invalid id token")
+
+// oidcVerifier verifies id tokens issued by an openid connect provider
+type oidcVerifier struct {
+	issuer   string
+	audience string
+	h        *Handler
+	mut      sync.Mutex
+	keys     map[string]crypto.PublicKey
+	fetched  time.Time
+}
+
+type idClaims struct {
+	Issuer    string          `json:"iss"`
+	Subject   string          `json:"sub"`
+	Email     string          `json:"email"`
+	Audience  json.RawMessage `json:"aud"`
+	Expiry    float64         `json:"exp"`
+	NotBefore float64         `json:"nbf"`
+}
+
+// hasAudience handles aud being either a string or a list
+func (c idClaims) hasAudience(aud string) bool {
+	one := ""
+	if json.Unmarshal(c.Audience, &one) == nil {
+		return one == aud
+	}
+	many := []string{}
+	json.Unmarshal(c.Audience, &many)
+	for _, a := range many {
+		if a == aud {
+			return true
+		}
+	}
+	return false
+}
+
+// verify checks the signature and claims of a compact jwt
+func (v *oidcVerifier) verify(ctx context.Context, token string) (idClaims, error) {
+	claims := idClaims{}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return claims, errBadIDToken
+	}
+	header := struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}{}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return claims, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return claims, errBadIDToken
+	}
+	key, err := v.key(ctx, header.Kid)
+	if err != nil {
+		return claims, err
+	}
+	if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], sig); err != nil {
+		return claims, err
+	}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return claims, err
+	}
+	now := float64(time.Now().Unix())
+	switch {
+	case claims.Issuer != v.issuer:
+		return claims, fmt.Errorf("%w: unexpected issuer", errBadIDToken)
+	case !claims.hasAudience(v.audience):
+		return claims, fmt.Errorf("%w: unexpected audience", errBadIDToken)
+	case claims.Expiry < now:
+		return claims, fmt.Errorf("%w: expired", errBadIDToken)
+	case claims.NotBefore > now:
+		return claims, fmt.Errorf("%w: not yet valid", errBadIDToken)
+	}
+	return claims, nil
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return errBadIDToken
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return errBadIDToken
+	}
+	return nil
+}
+
+func verifySignature(alg string, key crypto.PublicKey, signed string, sig []byte) error {
+	if len(alg) != 5 {
+		return fmt.Errorf("%w: unsupported alg %s", errBadIDToken, alg)
+	}
+	var hf func() hash.Hash
+	var ch crypto.Hash
+	switch alg[2:] {
+	case "256":
+		hf, ch = sha256.New, crypto.SHA256
+	case "384":
+		hf, ch = sha512.New384, crypto.SHA384
+	case "512":
+		hf, ch = sha512.New, crypto.SHA512
+	default:
+		return fmt.Errorf("%w: unsupported alg %s", errBadIDToken, alg)
+	}
+	hw := hf()
+	hw.Write([]byte(signed))
+	digest := hw.Sum(nil)
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if strings.HasPrefix(alg, "RS") && rsa.VerifyPKCS1v15(k, ch, digest, sig) == nil {
+			return nil
+		}
+	case *ecdsa.PublicKey:
+		n := len(sig) / 2
+		if strings.HasPrefix(alg, "ES") && len(sig)%2 == 0 &&
+			ecdsa.Verify(k, digest, new(big.Int).SetBytes(sig[:n]), new(big.Int).SetBytes(sig[n:])) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: bad signature", errBadIDToken)
+}
+
+// key returns the provider's signing key with the given id,
+// refetching the key set when the id is unknown
+func (v *oidcVerifier) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	v.mut.Lock()
+	defer v.mut.Unlock()
+	if k, ok := v.keys[kid]; ok {
+		return k, nil
+	}
+	if time.Since(v.fetched) < jwksRefresh {
+		return nil, fmt.Errorf("%w: unknown key %q", errBadIDToken, kid)
+	}
+	v.fetched = time.Now()
+	discovery := struct {
+		JWKSURI string `json:"jwks_uri"`
+	}{}
+	if err := v.fetch(ctx, strings.TrimSuffix(v.issuer, "/")+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, err
+	}
+	jwks := struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			Crv string `json:"crv"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}{}
+	if err := v.fetch(ctx, discovery.JWKSURI, &jwks); err != nil {
+		return nil, err
+	}
+	v.keys = map[string]crypto.PublicKey{}
+	for _, k := range jwks.Keys {
+		switch k.Kty {
+		case "RSA":
+			n, err1 := base64.RawURLEncoding.DecodeString(k.N)
+			e, err2 := base64.RawURLEncoding.DecodeString(k.E)
+			if err1 != nil || err2 != nil {
+				continue
+			}
+			v.keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case "EC":
+			curves := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}
+			x, err1 := base64.RawURLEncoding.DecodeString(k.X)
+			y, err2 := base64.RawURLEncoding.DecodeString(k.Y)
+			if curves[k.Crv] == nil || err1 != nil || err2 != nil {
+				continue
+			}
+			v.keys[k.Kid] = &ecdsa.PublicKey{Curve: curves[k.Crv], X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		}
+	}
+	if k, ok := v.keys[kid]; ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("%w: unknown key %q", errBadIDToken, kid)
+}
+
+func (v *oidcVerifier) fetch(ctx context.Context, url string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := v.h.do(req)
+	if err != nil {
+		return fmt.Errorf("oidc request failed: %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("oidc request failed: %s: %s", url, resp.Status)
+	}
+	return decodeJSON(resp.Body, out)
+}
@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+)
+
+// Option configures a handler created by New
+type Option func(*Handler)
+
+// New returns a handler starting from DefaultConfig, adjusted by
+// opts, e.g. to mount the installer within an existing server:
+//
+//	mux.Handle("/install/", handler.New(handler.WithPrefix("/install"), handler.WithToken(token)))
+func New(opts ...Option) http.Handler {
+	h := &Handler{Config: DefaultConfig}
+	for _, o := range opts {
+		o(h)
+	}
+	return h
+}
+
+// WithConfig replaces the whole configuration, later options
+// still apply on top of it
+func WithConfig(c Config) Option {
+	return func(h *Handler) { h.Config = c }
+}
+
+// WithToken authenticates github api requests
+func WithToken(token string) Option {
+	return func(h *Handler) { h.Config.Token = token }
+}
+
+// WithAPIURL resolves releases from another github api,
+// e.g. github enterprise or an internal caching mirror
+func WithAPIURL(url string) Option {
+	return func(h *Handler) { h.Config.APIURL = url }
+}
+
+// WithCache stores resolved releases in c instead of memory
+func WithCache(c Cache) Option {
+	return func(h *Handler) { h.Cache = c }
+}
+
+// WithTemplateDir overrides the embedded templates with
+// those present in dir
+func WithTemplateDir(dir string) Option {
+	return func(h *Handler) { h.Config.TemplateDir = dir }
+}
+
+// WithLevel lets /admin/loglevel adjust level, logs are
+// otherwise written with slog's default logger
+func WithLevel(level *slog.LevelVar) Option {
+	return func(h *Handler) { h.Level = level }
+}
+
+// WithAudit sends an entry for each served script to a
+func WithAudit(a AuditSink) Option {
+	return func(h *Handler) { h.Audit = a }
+}
+
+// WithReporter sends unexpected failures to r
+func WithReporter(r ErrorReporter) Option {
+	return func(h *Handler) { h.Reporter = r }
+}
+
+// WithPrefix mounts the handler under path (e.g. /install), which
+// is stripped from requests and kept in links the handler generates
+func WithPrefix(path string) Option {
+	return func(h *Handler) { h.Prefix = path }
+}
+
+// WithAssetFilter adds f to the asset filters
+func WithAssetFilter(f AssetFilter) Option {
+	return func(h *Handler) { h.AssetFilters = append(h.AssetFilters, f) }
+}
+
+// WithPostProcessor adds p to the post processors
+func WithPostProcessor(p PostProcessor) Option {
+	return func(h *Handler) { h.PostProcessors = append(h.PostProcessors, p) }
+}
+
+// WithAuthChecker adds c to the auth checkers
+func WithAuthChecker(c AuthChecker) Option {
+	return func(h *Handler) { h.AuthCheckers = append(h.AuthCheckers, c) }
+}
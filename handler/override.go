@@ -0,0 +1,42 @@
+package handler
+
+import "strings"
+
+const (
+	defaultVersionCommand    = "--version"
+	defaultCompletionCommand = "completion {shell}"
+)
+
+// Override adjusts how scripts handle a single user/repo
+type Override struct {
+	VersionCommand string //arguments printing the installed version (defaults to --version)
+	//CompletionCommand prints shell completions, with {shell}
+	//replaced by bash, zsh or fish (defaults to completion {shell})
+	CompletionCommand string
+	//Files are installed from the release besides the binary, as
+	//pattern=destination, where a destination ending in / is a directory
+	Files []string
+	//Capabilities are granted to the binary on linux with setcap,
+	//e.g. cap_net_bind_service=+ep
+	Capabilities string
+}
+
+// override returns the settings for user/repo, matched case insensitively
+func (h *Handler) override(user, program string) Override {
+	o := Override{VersionCommand: defaultVersionCommand, CompletionCommand: defaultCompletionCommand}
+	repo := strings.ToLower(user + "/" + program)
+	for k, v := range h.Config.Overrides {
+		if strings.ToLower(k) != repo {
+			continue
+		}
+		if v.VersionCommand != "" {
+			o.VersionCommand = v.VersionCommand
+		}
+		if v.CompletionCommand != "" {
+			o.CompletionCommand = v.CompletionCommand
+		}
+		o.Files = v.Files
+		o.Capabilities = v.Capabilities
+	}
+	return o
+}
@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// AssetFilter adjusts the assets of each resolved release, e.g. to
+// prefer musl builds or drop assets an organisation has not approved.
+// Filters run after caching, on every request.
+type AssetFilter interface {
+	FilterAssets(q Query, assets Assets) Assets
+}
+
+// AssetFilterFunc adapts a function to an AssetFilter
+type AssetFilterFunc func(q Query, assets Assets) Assets
+
+func (f AssetFilterFunc) FilterAssets(q Query, assets Assets) Assets {
+	return f(q, assets)
+}
+
+// PostProcessor rewrites rendered output before it is hashed,
+// signed and served, e.g. to append company specific setup.
+// The format is the template name (script, posix, homebrew, text,
+// uninstall or offline) or json.
+type PostProcessor interface {
+	PostProcess(format string, results []Result, body []byte) ([]byte, error)
+}
+
+// PostProcessorFunc adapts a function to a PostProcessor
+type PostProcessorFunc func(format string, results []Result, body []byte) ([]byte, error)
+
+func (f PostProcessorFunc) PostProcess(format string, results []Result, body []byte) ([]byte, error) {
+	return f(format, results, body)
+}
+
+// AuthChecker decides whether r may install q, after the built in
+// api key and tenant checks. Errors are shown to the client, with
+// status 403 unless the error is an *AuthError.
+type AuthChecker interface {
+	CheckAuth(r *http.Request, q Query) error
+}
+
+// AuthCheckerFunc adapts a function to an AuthChecker
+type AuthCheckerFunc func(r *http.Request, q Query) error
+
+func (f AuthCheckerFunc) CheckAuth(r *http.Request, q Query) error {
+	return f(r, q)
+}
+
+// AuthError is returned by an AuthChecker to choose the status, e.g.
+// 401 to ask the client for credentials
+type AuthError struct {
+	Status  int
+	Message string
+}
+
+func (e *AuthError) Error() string {
+	return e.Message
+}
+
+// filterAssets applies the registered asset filters
+func (h *Handler) filterAssets(result Result) (Result, error) {
+	for _, f := range h.AssetFilters {
+		result.Assets = f.FilterAssets(result.Query, result.Assets)
+	}
+	if len(h.AssetFilters) > 0 && len(result.Assets) == 0 {
+		return result, fmt.Errorf("downloads for this release %w", errNotFound)
+	}
+	return result, nil
+}
+
+// postProcess applies the registered post processors
+func (h *Handler) postProcess(format string, results []Result, body []byte) ([]byte, error) {
+	for _, p := range h.PostProcessors {
+		var err error
+		if body, err = p.PostProcess(format, results, body); err != nil {
+			return nil, err
+		}
+	}
+	return body, nil
+}
+
+// checkAuth applies the registered auth checkers,
+// returning the status to respond with on failure
+func (h *Handler) checkAuth(r *http.Request, q Query) (int, error) {
+	for _, c := range h.AuthCheckers {
+		if err := c.CheckAuth(r, q); err != nil {
+			var ae *AuthError
+			if errors.As(err, &ae) && ae.Status != 0 {
+				return ae.Status, err
+			}
+			return http.StatusForbidden, err
+		}
+	}
+	return 0, nil
+}
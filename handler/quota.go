@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// quotas limit installs per hour for each github user or org,
+// so a single popular owner can't exhaust the shared api budget
+type quotas []quota
+
+type quota struct {
+	pattern string
+	limiter *limiter
+}
+
+// newQuotas parses pattern=limit rules, where
+// the first matching pattern applies
+func newQuotas(rules []string) quotas {
+	qs := quotas{}
+	for _, rule := range rules {
+		pattern, limit := splitHalf(rule, "=")
+		n, err := strconv.Atoi(strings.TrimSpace(limit))
+		if pattern == "" || err != nil || n < 0 {
+			slog.Warn("ignoring invalid org quota, expected pattern=limit", "rule", rule)
+			continue
+		}
+		qs = append(qs, quota{
+			pattern: strings.TrimSpace(pattern),
+			limiter: newLimiter(n, time.Hour),
+		})
+	}
+	return qs
+}
+
+// allow takes an install from the owner's quota
+func (qs quotas) allow(owner string) (bool, time.Duration) {
+	for _, q := range qs {
+		if matchAny([]string{q.pattern}, owner) {
+			if q.limiter == nil {
+				//explicit zero quota is unlimited
+				return true, 0
+			}
+			return q.limiter.allow(strings.ToLower(owner))
+		}
+	}
+	return true, 0
+}
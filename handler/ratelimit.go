@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"container/list"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const maxBuckets = 10000
+
+// limiter is a set of token buckets, each allowing
+// rate requests per period with an equal burst. At most
+// maxBuckets are kept, evicting the least recently used.
+type limiter struct {
+	mut     sync.Mutex
+	rate    float64
+	period  time.Duration
+	buckets map[string]*list.Element
+	recent  *list.List //of buckets, most recently used first
+}
+
+type bucket struct {
+	key    string
+	tokens float64
+	last   time.Time
+}
+
+func newLimiter(rate int, period time.Duration) *limiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &limiter{
+		rate:    float64(rate),
+		period:  period,
+		buckets: map[string]*list.Element{},
+		recent:  list.New(),
+	}
+}
+
+// allow takes a token from the given key's bucket, and when
+// empty, returns how long until the next token is available
+func (l *limiter) allow(key string) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	now := time.Now()
+	e, ok := l.buckets[key]
+	if ok {
+		l.recent.MoveToFront(e)
+	} else {
+		if len(l.buckets) >= maxBuckets {
+			oldest := l.recent.Back()
+			l.recent.Remove(oldest)
+			delete(l.buckets, oldest.Value.(*bucket).key)
+		}
+		e = l.recent.PushFront(&bucket{key: key, tokens: l.rate, last: now})
+		l.buckets[key] = e
+	}
+	b := e.Value.(*bucket)
+	//refill
+	b.tokens = math.Min(l.rate, b.tokens+l.refill(now.Sub(b.last)))
+	b.last = now
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.rate * float64(l.period))
+		return false, wait
+	}
+	b.tokens--
+	return true, 0
+}
+
+// refill is the number of tokens gained over d
+func (l *limiter) refill(d time.Duration) float64 {
+	return float64(d) / float64(l.period) * l.rate
+}
+
+// limitKey identifies the client for rate limiting, in
+// privacy mode raw ips are not even held in memory
+func (h *Handler) limitKey(r *http.Request) string {
+	ip := clientIP(r, h.Config.TrustProxy)
+	if h.Config.Privacy {
+		return h.clientID(ip)
+	}
+	return ip
+}
+
+// clientIP returns the address of the client, which when behind a
+// trusted proxy, is the last address it appended to X-Forwarded-For
+func clientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+			ips := strings.Split(xff, ",")
+			return strings.TrimSpace(ips[len(ips)-1])
+		}
+		if ip := r.Header.Get("X-Real-Ip"); ip != "" {
+			return ip
+		}
+	}
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
+// retryAfter formats a Retry-After header value in whole seconds
+func retryAfter(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
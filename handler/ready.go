@@ -0,0 +1,41 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// readyTTL limits how often probes reach github
+const readyTTL = 10 * time.Second
+
+// ready reports whether github is usable: reachable, the configured
+// token is valid and enough of its quota remains
+func (h *Handler) ready(ctx context.Context) error {
+	h.readyMut.Lock()
+	defer h.readyMut.Unlock()
+	if time.Since(h.readyChecked) < readyTTL {
+		return h.readyErr
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	info, err := h.CheckToken(ctx)
+	if err == nil && info.Remaining < h.Config.ReadyRemaining {
+		err = fmt.Errorf("only %d github requests remaining until %s",
+			info.Remaining, info.Reset.Format(time.Kitchen))
+	}
+	if wait := h.rateLimited(); err == nil && wait > 0 {
+		err = fmt.Errorf("backing off from github for %s", wait.Round(time.Second))
+	}
+	h.readyChecked, h.readyErr = time.Now(), err
+	return err
+}
+
+func (h *Handler) serveReady(w http.ResponseWriter, r *http.Request) {
+	if err := h.ready(r.Context()); err != nil {
+		http.Error(w, "Not ready: "+err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("OK"))
+}
@@ -0,0 +1,211 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+const configPollInterval = 5 * time.Second
+
+// ReadConfigFile overlays the json, yaml or toml settings in
+// c.ConfigFile onto c, settings missing from the file keep their
+// current value. Reading the result again starts over from c, so
+// settings removed from the file revert to their flag or env value.
+func ReadConfigFile(c Config) (Config, error) {
+	if c.ConfigFile == "" {
+		return c, nil
+	}
+	if c.base != nil {
+		c = *c.base
+	}
+	base := c
+	b, err := os.ReadFile(c.ConfigFile)
+	if err != nil {
+		return c, err
+	}
+	raw := map[string]interface{}{}
+	switch strings.ToLower(filepath.Ext(c.ConfigFile)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &raw)
+	case ".toml":
+		err = toml.Unmarshal(b, &raw)
+	default:
+		err = json.Unmarshal(b, &raw)
+	}
+	if err != nil {
+		return c, fmt.Errorf("invalid config file: %w", err)
+	}
+	settings, err := configFields(raw)
+	if err != nil {
+		return c, fmt.Errorf("invalid config file: %w", err)
+	}
+	//json is the common denominator of all formats, and each
+	//setting replaces its field, since json merges into maps
+	cv := reflect.ValueOf(&c).Elem()
+	for name, v := range settings {
+		f := cv.FieldByName(name)
+		p := reflect.New(f.Type())
+		if b, err = json.Marshal(v); err == nil {
+			err = json.Unmarshal(b, p.Interface())
+		}
+		if err != nil {
+			return c, fmt.Errorf("invalid config file: setting %q: %w", name, err)
+		}
+		f.Set(p.Elem())
+	}
+	c.base = &base
+	return c, nil
+}
+
+// configFields maps settings onto Config field names, accepting
+// any case, dashes or underscores (e.g. RateLimit, rate-limit or
+// rate_limit) and durations as strings (e.g. 30s)
+func configFields(raw map[string]interface{}) (map[string]interface{}, error) {
+	fields := map[string]reflect.StructField{}
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).IsExported() {
+			fields[strings.ToLower(t.Field(i).Name)] = t.Field(i)
+		}
+	}
+	settings := map[string]interface{}{}
+	for k, v := range raw {
+		f, ok := fields[strings.NewReplacer("-", "", "_", "").Replace(strings.ToLower(k))]
+		if !ok {
+			return nil, fmt.Errorf("unknown setting %q", k)
+		}
+		if s, ok := v.(string); ok && f.Type == reflect.TypeOf(time.Duration(0)) {
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return nil, fmt.Errorf("setting %q: %w", k, err)
+			}
+			v = d
+		}
+		settings[f.Name] = v
+	}
+	return settings, nil
+}
+
+// watchConfig reloads the config file whenever it changes
+func (h *Handler) watchConfig(path string) {
+	last := time.Time{}
+	if info, err := os.Stat(path); err == nil {
+		last = info.ModTime()
+	}
+	for range time.Tick(configPollInterval) {
+		info, err := os.Stat(path)
+		if err != nil || info.ModTime().Equal(last) {
+			continue
+		}
+		last = info.ModTime()
+		if err := h.Reload(); err != nil {
+			slog.Error("config reload failed", "err", err)
+		}
+	}
+}
+
+// Reload re-reads the config file and applies it once in-flight
+// requests complete, keeping the cache warm. Listener and log file
+// settings still require a restart.
+func (h *Handler) Reload() error {
+	h.initOnce.Do(h.init)
+	h.configMut.RLock()
+	c, err := ReadConfigFile(h.Config)
+	h.configMut.RUnlock()
+	if err != nil {
+		return err
+	}
+	h.apply(c)
+	return nil
+}
+
+func (h *Handler) apply(c Config) {
+	h.configMut.Lock()
+	defer h.configMut.Unlock()
+	h.Config = c
+	h.configure()
+	if h.Level != nil && c.LogLevel != "" {
+		if err := h.Level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+			slog.Warn("invalid log level", "err", err)
+		}
+	}
+	slog.Info("config reloaded", "file", c.ConfigFile)
+}
+
+// serveReload validates the config file, then applies it in the
+// background since this request holds the config open
+func (h *Handler) serveReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.Config.ConfigFile == "" {
+		http.Error(w, "No config file", http.StatusNotFound)
+		return
+	}
+	c, err := ReadConfigFile(h.Config)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	go h.apply(c)
+	w.WriteHeader(http.StatusAccepted)
+	writeJSON(w, map[string]string{"reloading": c.ConfigFile})
+}
+
+// serveLogLevel shows or changes the log level, optionally
+// reverting after ?for=<duration>
+func (h *Handler) serveLogLevel(w http.ResponseWriter, r *http.Request) {
+	if h.Level == nil {
+		http.Error(w, "Log level is not adjustable", http.StatusNotFound)
+		return
+	}
+	if r.Method == http.MethodPost || r.Method == http.MethodPut {
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(r.URL.Query().Get("level"))); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		revert := time.Duration(0)
+		if s := r.URL.Query().Get("for"); s != "" {
+			d, err := time.ParseDuration(s)
+			if err != nil || d <= 0 {
+				http.Error(w, "Invalid duration", http.StatusBadRequest)
+				return
+			}
+			revert = d
+		}
+		h.setLevel(level, revert)
+	}
+	writeJSON(w, map[string]string{"level": h.Level.Level().String()})
+}
+
+func (h *Handler) setLevel(level slog.Level, revert time.Duration) {
+	h.levelMut.Lock()
+	defer h.levelMut.Unlock()
+	prev := h.Level.Level()
+	if h.levelTimer != nil && h.levelTimer.Stop() {
+		//still bumped, later revert to the original level
+		prev = h.levelPrev
+	}
+	h.levelTimer = nil
+	h.Level.Set(level)
+	slog.Info("log level changed", "level", level, "revert", revert)
+	if revert > 0 {
+		h.levelPrev = prev
+		h.levelTimer = time.AfterFunc(revert, func() {
+			h.Level.Set(prev)
+			slog.Info("log level reverted", "level", prev)
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// upstreamFailures is the number of consecutive failed
+// github requests which are reported as an outage
+const upstreamFailures = 3
+
+// ErrorReport describes an unexpected failure
+type ErrorReport struct {
+	Time    time.Time `json:"time"`
+	Kind    string    `json:"kind"` //template, panic or upstream
+	Message string    `json:"message"`
+	Path    string    `json:"path,omitempty"`
+	Repo    string    `json:"repo,omitempty"`
+	Type    string    `json:"type,omitempty"`
+	//RequestID correlates the report with request logs
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// ErrorReporter receives unexpected failures, so operators
+// learn about breakage before users complain
+type ErrorReporter interface {
+	Report(ErrorReport)
+}
+
+type reporters []ErrorReporter
+
+func (rs reporters) Report(e ErrorReport) {
+	for _, r := range rs {
+		r.Report(e)
+	}
+}
+
+// report sends an error report when a reporter is configured
+func (h *Handler) report(ctx context.Context, e ErrorReport) {
+	if h.Reporter == nil {
+		return
+	}
+	e.Time = time.Now().UTC()
+	e.RequestID = requestID(ctx)
+	h.Reporter.Report(e)
+}
+
+// upstreamResult tracks consecutive upstream failures,
+// reporting once when they reach upstreamFailures
+func (h *Handler) upstreamResult(ctx context.Context, err error) {
+	if err == nil {
+		h.upstreamFails.Store(0)
+		return
+	}
+	if h.upstreamFails.Add(1) == upstreamFailures {
+		h.report(ctx, ErrorReport{
+			Kind:    "upstream",
+			Message: fmt.Sprintf("%d consecutive github requests failed, last: %s", upstreamFailures, err),
+		})
+	}
+}
+
+// webhookReporter posts reports as json, including a
+// text field so slack compatible webhooks can display them
+type webhookReporter struct {
+	url string
+	h   *Handler
+}
+
+func (wr *webhookReporter) Report(e ErrorReport) {
+	text := fmt.Sprintf("installer %s error: %s", e.Kind, e.Message)
+	if e.Repo != "" {
+		text += " (" + e.Repo + ")"
+	}
+	b, _ := json.Marshal(struct {
+		ErrorReport
+		Text string `json:"text"`
+	}{e, text})
+	go wr.h.postWebhook(wr.url, b)
+}
+
+// postWebhook sends a json payload to an operator configured
+// url, with optional header key value pairs. It runs outside
+// of requests, so must not be called while serving one.
+func (h *Handler) postWebhook(url string, body []byte, headers ...string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		slog.Warn("webhook failed", "err", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	h.configMut.RLock()
+	req.Header.Set("User-Agent", h.userAgent())
+	h.configMut.RUnlock()
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	if err := h.guardURL(req.URL); err != nil {
+		slog.Warn("webhook failed", "err", err)
+		return
+	}
+	resp, err := h.client().Do(req)
+	if err != nil {
+		slog.Warn("webhook failed", "err", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		slog.Warn("webhook failed", "status", resp.StatusCode)
+	}
+}
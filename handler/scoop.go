@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+const bucketPath = "/scoop-bucket"
+
+// scoopArches maps asset arches to scoop's architecture names
+var scoopArches = map[string]string{"amd64": "64bit", "386": "32bit", "arm64": "arm64"}
+
+// scoopManifest is a scoop app manifest
+type scoopManifest struct {
+	Version      string               `json:"version"`
+	Description  string               `json:"description"`
+	Homepage     string               `json:"homepage"`
+	Architecture map[string]scoopArch `json:"architecture"`
+	PreInstall   []string             `json:"pre_install,omitempty"`
+	Bin          string               `json:"bin"`
+}
+
+type scoopArch struct {
+	URL  string `json:"url"`
+	Hash string `json:"hash,omitempty"`
+}
+
+// serveBucket serves a scoop bucket of Config.ScoopRepos as a git
+// repository, so windows users scoop bucket add the server
+func (h *Handler) serveBucket(w http.ResponseWriter, r *http.Request) {
+	h.serveGit(w, r, &h.bucket, bucketPath, h.refreshBucket)
+}
+
+// refreshBucket writes a manifest for each repo, where repos which
+// fail to resolve keep their previous manifest rather than vanishing
+func (h *Handler) refreshBucket(ctx context.Context) error {
+	files := map[string][]byte{}
+	names := []string{}
+	for _, repo := range SplitList(h.Config.ScoopRepos) {
+		_, program := splitHalf(repo, "/")
+		name := strings.ToLower(program)
+		path := "bucket/" + name + ".json"
+		manifest, err := h.manifest(ctx, repo)
+		if err != nil {
+			slog.Warn("scoop manifest failed", "repo", repo, "err", err)
+			prev, ok := h.bucket.file(path)
+			if !ok {
+				continue
+			}
+			manifest = prev
+		}
+		files[path] = manifest
+		names = append(names, name)
+	}
+	files["README.md"] = gitReadme("scoop bucket", h.Config.ScoopRepos)
+	h.bucket.update(files, "Update "+strings.Join(names, ", "))
+	return nil
+}
+
+// manifest generates the scoop manifest of repo from its windows assets
+func (h *Handler) manifest(ctx context.Context, repo string) ([]byte, error) {
+	result, err := h.resolveRepo(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+	assets, err := h.policy(result.Windows, result.RequireChecksum)
+	if err != nil {
+		return nil, err
+	}
+	exe := result.Program + ".exe"
+	m := scoopManifest{
+		Version:      strings.TrimPrefix(result.Release, "v"),
+		Description:  result.Program + ", installed from its github releases",
+		Homepage:     "https://github.com/" + result.User + "/" + result.Program,
+		Architecture: map[string]scoopArch{},
+		Bin:          exe,
+	}
+	archive := false
+	for _, a := range assets {
+		arch, ok := scoopArches[a.Arch]
+		if !ok {
+			continue
+		}
+		sa := scoopArch{URL: a.URL, Hash: strings.ToLower(a.SHA256)}
+		// plain executables are renamed by the url fragment,
+		// archives are searched for the largest executable
+		if a.Type == ".exe" || a.Type == ".bin" {
+			sa.URL += "#/" + exe
+		} else {
+			archive = true
+		}
+		m.Architecture[arch] = sa
+	}
+	if len(m.Architecture) == 0 {
+		return nil, errors.New("no windows assets")
+	}
+	if archive {
+		m.PreInstall = []string{
+			`if (!(Test-Path "$dir\` + exe + `")) { Get-ChildItem $dir -Recurse -Filter *.exe | ` +
+				`Sort-Object Length -Descending | Select-Object -First 1 | Move-Item -Destination "$dir\` + exe + `" }`,
+		}
+	}
+	b, err := json.MarshalIndent(m, "", "    ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
@@ -1,8 +1,9 @@
 package handler
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"regexp"
@@ -12,14 +13,14 @@ var searchGithubRe = regexp.MustCompile(`https:\/\/github\.com\/(\w+)\/(\w+)`)
 
 //uses im feeling lucky and grabs the "Location"
 //header from the 302, which contains the github repo
-func searchGoogle(phrase string) (user, project string, err error) {
+func (h *Handler) searchGoogle(ctx context.Context, phrase string) (user, project string, err error) {
 	phrase += " site:github.com"
-	log.Printf("google search for '%s'", phrase)
+	slog.Debug("google search", "phrase", phrase)
 	v := url.Values{}
 	v.Set("btnI", "") //I'm feeling lucky
 	v.Set("q", phrase)
 	urlstr := "https://www.google.com/search?" + v.Encode()
-	req, err := http.NewRequest("GET", urlstr, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", urlstr, nil)
 	if err != nil {
 		return "", "", err
 	}
@@ -27,7 +28,10 @@ func searchGoogle(phrase string) (user, project string, err error) {
 	//I'm a browser... :)
 	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_3) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/81.0.4044.122 Safari/537.36")
 	//roundtripper doesn't follow redirects
-	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err := h.guardURL(req.URL); err != nil {
+		return "", "", err
+	}
+	resp, err := h.client().Transport.RoundTrip(req)
 	if err != nil {
 		return "", "", fmt.Errorf("request failed: %s", err)
 	}
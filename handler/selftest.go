@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// selfTest records the outcome of periodically resolving a
+// known-good repo, so monitoring can tell an upstream outage
+// apart from a lack of traffic
+type selfTest struct {
+	mut      sync.Mutex
+	runs     int
+	failures int
+	ok       bool
+	latency  time.Duration
+	last     time.Time
+}
+
+// runSelfTests resolves the canary repo now and then every interval
+func (h *Handler) runSelfTests(repo string, interval time.Duration) {
+	user, program, _ := strings.Cut(repo, "/")
+	q := Query{User: user, Program: program}
+	if interval <= 0 {
+		interval = DefaultConfig.SelfTestInterval
+	}
+	for {
+		h.selfTestOnce(q)
+		time.Sleep(interval)
+	}
+}
+
+func (h *Handler) selfTestOnce(q Query) {
+	h.configMut.RLock()
+	defer h.configMut.RUnlock()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	t0 := time.Now()
+	//bypass the cache, the point is to reach github
+	_, _, _, err := h.getAssetsNoCache(ctx, q)
+	latency := time.Since(t0)
+	st := &h.selfTest
+	st.mut.Lock()
+	st.runs++
+	st.ok = err == nil
+	st.latency = latency
+	st.last = t0
+	if err != nil {
+		st.failures++
+	}
+	st.mut.Unlock()
+	if err != nil {
+		slog.Warn("self test failed", "repo", q.User+"/"+q.Program, "err", err, "latency", latency)
+	} else {
+		slog.Debug("self test passed", "repo", q.User+"/"+q.Program, "latency", latency)
+	}
+}
+
+// writeMetrics appends the self test results in the prometheus format
+func (st *selfTest) writeMetrics(w io.Writer) {
+	st.mut.Lock()
+	defer st.mut.Unlock()
+	if st.runs == 0 {
+		return
+	}
+	ok := 0
+	if st.ok {
+		ok = 1
+	}
+	metric(w, "installer_selftest_runs_total", "counter", "Self test resolutions of the canary repo.")
+	fmt.Fprintf(w, "installer_selftest_runs_total %d\n", st.runs)
+	metric(w, "installer_selftest_failures_total", "counter", "Self test resolutions of the canary repo that failed.")
+	fmt.Fprintf(w, "installer_selftest_failures_total %d\n", st.failures)
+	metric(w, "installer_selftest_success", "gauge", "Whether the last self test succeeded.")
+	fmt.Fprintf(w, "installer_selftest_success %d\n", ok)
+	metric(w, "installer_selftest_duration_seconds", "gauge", "Duration of the last self test.")
+	fmt.Fprintf(w, "installer_selftest_duration_seconds %g\n", st.latency.Seconds())
+	metric(w, "installer_selftest_last_run_timestamp_seconds", "gauge", "Unix time of the last self test.")
+	fmt.Fprintf(w, "installer_selftest_last_run_timestamp_seconds %d\n", st.last.Unix())
+}
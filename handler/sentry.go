@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// sentryReporter sends reports to sentry's store endpoint,
+// tagged with their kind, repo and response type
+type sentryReporter struct {
+	store string
+	auth  string
+	h     *Handler
+}
+
+// newSentryReporter parses a dsn of the form
+// https://<key>@<host>[/<path>]/<project>
+func newSentryReporter(dsn string, h *Handler) (*sentryReporter, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, err
+	}
+	i := strings.LastIndex(u.Path, "/")
+	if u.User == nil || u.User.Username() == "" || i == -1 || u.Path[i+1:] == "" {
+		return nil, errors.New("invalid sentry dsn")
+	}
+	store := fmt.Sprintf("%s://%s%s/api/%s/store/", u.Scheme, u.Host, u.Path[:i], u.Path[i+1:])
+	auth := fmt.Sprintf("Sentry sentry_version=7, sentry_client=installer/%s, sentry_key=%s", Version, u.User.Username())
+	if secret, ok := u.User.Password(); ok {
+		auth += ", sentry_secret=" + secret
+	}
+	return &sentryReporter{store: store, auth: auth, h: h}, nil
+}
+
+func (s *sentryReporter) Report(e ErrorReport) {
+	id := make([]byte, 16)
+	rand.Read(id)
+	tags := map[string]string{"kind": e.Kind}
+	if e.Repo != "" {
+		tags["repo"] = e.Repo
+	}
+	if e.Type != "" {
+		tags["type"] = e.Type
+	}
+	event := map[string]interface{}{
+		"event_id":  hex.EncodeToString(id),
+		"timestamp": e.Time.Format("2006-01-02T15:04:05Z"),
+		"level":     "error",
+		"platform":  "go",
+		"logger":    "installer",
+		"release":   Version,
+		"message":   e.Message,
+		"tags":      tags,
+		"exception": map[string]interface{}{
+			"values": []map[string]string{{"type": e.Kind, "value": e.Message}},
+		},
+	}
+	if e.RequestID != "" {
+		tags["request_id"] = e.RequestID
+	}
+	if e.Path != "" {
+		event["extra"] = map[string]string{"path": e.Path}
+	}
+	b, _ := json.Marshal(event)
+	go s.h.postWebhook(s.store, b, "X-Sentry-Auth", s.auth)
+}
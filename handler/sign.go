@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// signer produces minisign compatible signatures,
+// verifiable with: minisign -Vm <file> -P <public key>
+type signer struct {
+	key   ed25519.PrivateKey
+	keyID [8]byte
+}
+
+// newSigner loads a base64 encoded ed25519 seed or private key
+func newSigner(b64 string) (*signer, error) {
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(b64))
+	if err != nil {
+		return nil, fmt.Errorf("invalid signing key: %s", err)
+	}
+	s := &signer{}
+	switch len(b) {
+	case ed25519.SeedSize:
+		s.key = ed25519.NewKeyFromSeed(b)
+	case ed25519.PrivateKeySize:
+		s.key = ed25519.PrivateKey(b)
+	default:
+		return nil, errors.New("invalid signing key: expected a 32 byte ed25519 seed")
+	}
+	//minisign key ids are random, derive ours from the public key
+	sum := sha256.Sum256(s.key.Public().(ed25519.PublicKey))
+	copy(s.keyID[:], sum[:8])
+	return s, nil
+}
+
+// publicKey returns the public key in minisign's format
+func (s *signer) publicKey() string {
+	b := bytes.Buffer{}
+	b.WriteString("Ed")
+	b.Write(s.keyID[:])
+	b.Write(s.key.Public().(ed25519.PublicKey))
+	return fmt.Sprintf("untrusted comment: minisign public key %016X\n%s\n",
+		binary.LittleEndian.Uint64(s.keyID[:]), base64.StdEncoding.EncodeToString(b.Bytes()))
+}
+
+// sign returns a prehashed minisign signature of msg
+func (s *signer) sign(msg []byte, name string) []byte {
+	hash := blake2b.Sum512(msg)
+	raw := ed25519.Sign(s.key, hash[:])
+	sig := bytes.Buffer{}
+	sig.WriteString("ED")
+	sig.Write(s.keyID[:])
+	sig.Write(raw)
+	//the trusted comment is signed along with the signature
+	trusted := fmt.Sprintf("timestamp:%d\tfile:%s\thashed", time.Now().Unix(), name)
+	global := ed25519.Sign(s.key, append(raw, trusted...))
+	return []byte(fmt.Sprintf("untrusted comment: signature from installer\n%s\ntrusted comment: %s\n%s\n",
+		base64.StdEncoding.EncodeToString(sig.Bytes()), trusted, base64.StdEncoding.EncodeToString(global)))
+}
@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+const maxRedirects = 5
+
+var (
+	errUnsafeURL = errors.New("refusing unsafe upstream url")
+	cgnatNet     = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+)
+
+// guard prevents upstream urls (which are chosen by github, release
+// authors and eventually users) from reaching private networks. hosts
+// configured by the operator (api mirror, proxies) are trusted, by
+// host and port.
+type guard struct {
+	disabled bool
+	trusted  map[string]bool
+	dialer   *net.Dialer
+}
+
+func newGuard(c Config) *guard {
+	g := &guard{
+		disabled: c.AllowPrivate,
+		trusted:  map[string]bool{},
+		dialer:   &net.Dialer{},
+	}
+	for _, u := range []string{
+		c.APIURL, c.AssetMirror, c.ProxyURL, c.OIDCIssuer, c.ErrorWebhook, c.QuotaWebhook,
+		os.Getenv("HTTP_PROXY"), os.Getenv("http_proxy"),
+		os.Getenv("HTTPS_PROXY"), os.Getenv("https_proxy"),
+	} {
+		if u == "" {
+			continue
+		}
+		if pu, err := url.Parse(u); err == nil && pu.Hostname() != "" {
+			g.trusted[hostPort(pu)] = true
+		}
+	}
+	return g
+}
+
+// hostPort is the lower case host:port of u, with the scheme's default port
+func hostPort(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		port = map[string]string{"http": "80", "https": "443", "socks5": "1080", "socks5h": "1080"}[u.Scheme]
+	}
+	return strings.ToLower(net.JoinHostPort(u.Hostname(), port))
+}
+
+// checkURL only allows https, except to trusted hosts
+func (g *guard) checkURL(u *url.URL) error {
+	if g.disabled || g.trusted[hostPort(u)] {
+		return nil
+	}
+	if u.Scheme != "https" {
+		return fmt.Errorf("%w: %s", errUnsafeURL, u.Redacted())
+	}
+	return nil
+}
+
+// checkRedirect enforces the redirect policy
+func (g *guard) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	return g.checkURL(req.URL)
+}
+
+// dial resolves the address itself, refusing private ranges, and
+// then dials the checked ip to prevent dns rebinding
+func (g *guard) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if g.disabled || g.trusted[strings.ToLower(addr)] {
+		return g.dialer.DialContext(ctx, network, addr)
+	}
+	ips, err := g.resolve(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	//fall back like net.Dialer, e.g. ipv6 without a route
+	for _, ip := range ips {
+		var conn net.Conn
+		if conn, err = g.dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port)); err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
+
+// proxy wraps the transport's proxy selection, since only the proxy
+// is dialed, targets are resolved and checked here instead. The proxy
+// resolves them again, so unlike direct requests, dns rebinding is
+// still possible.
+func (g *guard) proxy(next func(*http.Request) (*url.URL, error)) func(*http.Request) (*url.URL, error) {
+	return func(req *http.Request) (*url.URL, error) {
+		p, err := next(req)
+		if err != nil || p == nil || g.disabled || g.trusted[hostPort(req.URL)] {
+			return p, err
+		}
+		if _, err := g.resolve(req.Context(), req.URL.Hostname()); err != nil {
+			return nil, err
+		}
+		return p, nil
+	}
+}
+
+// resolve looks up host, refusing private ranges
+func (g *guard) resolve(ctx context.Context, host string) ([]net.IP, error) {
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]net.IP, 0, len(ips))
+	for _, ip := range ips {
+		if privateIP(ip.IP) {
+			return nil, fmt.Errorf("%w: %s resolves to private address %s", errUnsafeURL, host, ip.IP)
+		}
+		out = append(out, ip.IP)
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no addresses found for %s", host)
+	}
+	return out, nil
+}
+
+func privateIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || cgnatNet.Contains(ip)
+}
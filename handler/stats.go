@@ -0,0 +1,369 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	maxRecentErrors = 50
+	statsInterval   = time.Minute
+)
+
+// stats are in-memory request counters shown to operators
+type stats struct {
+	mut      sync.Mutex
+	repos    map[string]int
+	errors   []requestError
+	installs map[installKey]int
+	health   map[string]*repoHealth
+	//platforms counts installs by client os/arch
+	platforms map[string]int
+}
+
+// installKey identifies what was installed, never by whom
+type installKey struct {
+	Repo     string `json:"repo"`
+	Version  string `json:"version"`
+	Platform string `json:"platform"`
+}
+
+type installCount struct {
+	installKey
+	Installs int `json:"installs"`
+}
+
+type requestError struct {
+	Time   time.Time `json:"time"`
+	Path   string    `json:"path"`
+	Status int       `json:"status"`
+	Error  string    `json:"error"`
+	//RequestID correlates the error with request logs
+	RequestID string `json:"request_id"`
+}
+
+type repoCount struct {
+	Repo     string `json:"repo"`
+	Requests int    `json:"requests"`
+}
+
+// request counts a request for the given user/repo
+func (s *stats) request(repo string) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if s.repos == nil {
+		s.repos = map[string]int{}
+	}
+	if _, ok := s.repos[repo]; !ok && len(s.repos) >= maxBuckets {
+		return
+	}
+	s.repos[repo]++
+}
+
+// error records a failed request, keeping only the most recent
+func (s *stats) error(e requestError) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.errors = append(s.errors, e)
+	if len(s.errors) > maxRecentErrors {
+		s.errors = s.errors[len(s.errors)-maxRecentErrors:]
+	}
+}
+
+// top returns the n most requested repos
+func (s *stats) top(n int) []repoCount {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	counts := make([]repoCount, 0, len(s.repos))
+	for repo, c := range s.repos {
+		counts = append(counts, repoCount{repo, c})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Requests != counts[j].Requests {
+			return counts[i].Requests > counts[j].Requests
+		}
+		return counts[i].Repo < counts[j].Repo
+	})
+	if len(counts) > n {
+		counts = counts[:n]
+	}
+	return counts
+}
+
+// recent returns the recorded errors, newest first
+func (s *stats) recent() []requestError {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	out := make([]requestError, len(s.errors))
+	for i, e := range s.errors {
+		out[len(out)-1-i] = e
+	}
+	return out
+}
+
+// install counts a served install script
+func (s *stats) install(k installKey) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if s.installs == nil {
+		s.installs = map[installKey]int{}
+	}
+	if _, ok := s.installs[k]; !ok && len(s.installs) >= maxBuckets {
+		return
+	}
+	s.installs[k]++
+}
+
+type platformCount struct {
+	Platform string `json:"platform"`
+	Installs int    `json:"installs"`
+}
+
+// platform counts an install by client os and arch, of
+// which there are few, so no bucket limit is needed
+func (s *stats) platform(os, arch string) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if s.platforms == nil {
+		s.platforms = map[string]int{}
+	}
+	s.platforms[os+"/"+arch]++
+}
+
+// platformCounts returns installs per platform, most common first
+func (s *stats) platformCounts() []platformCount {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	counts := []platformCount{}
+	for p, n := range s.platforms {
+		counts = append(counts, platformCount{p, n})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Installs != counts[j].Installs {
+			return counts[i].Installs > counts[j].Installs
+		}
+		return counts[i].Platform < counts[j].Platform
+	})
+	return counts
+}
+
+// installCounts returns install counts, optionally of a single repo
+func (s *stats) installCounts(repo string) []installCount {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	counts := []installCount{}
+	for k, n := range s.installs {
+		if repo == "" || strings.EqualFold(k.Repo, repo) {
+			counts = append(counts, installCount{k, n})
+		}
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		a, b := counts[i].installKey, counts[j].installKey
+		if a.Repo != b.Repo {
+			return a.Repo < b.Repo
+		}
+		if a.Version != b.Version {
+			return a.Version < b.Version
+		}
+		return a.Platform < b.Platform
+	})
+	return counts
+}
+
+// repoHealth counts resolution outcomes of a repo, so maintainers
+// can learn when a release broke installs
+type repoHealth struct {
+	Repo      string  `json:"repo"`
+	Requests  int     `json:"requests"`
+	NotFound  int     `json:"not_found"`
+	Upstream  int     `json:"upstream"`
+	ErrorRate float64 `json:"error_rate"`
+	//Missing counts clients whose platform had no asset
+	Missing   map[string]int `json:"missing_platforms,omitempty"`
+	LastError string         `json:"last_error,omitempty"`
+}
+
+func (s *stats) repoHealth(repo string) *repoHealth {
+	if s.health == nil {
+		s.health = map[string]*repoHealth{}
+	}
+	key := strings.ToLower(repo)
+	rh, ok := s.health[key]
+	if !ok {
+		if len(s.health) >= maxBuckets {
+			return nil
+		}
+		rh = &repoHealth{Repo: repo}
+		s.health[key] = rh
+	}
+	return rh
+}
+
+// resolved records the outcome of resolving a repo, policy
+// refusals and abandoned requests are not counted
+func (s *stats) resolved(repo string, err error) {
+	if errors.Is(err, errForbidden) || errors.Is(err, context.Canceled) {
+		return
+	}
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	rh := s.repoHealth(repo)
+	if rh == nil {
+		return
+	}
+	rh.Requests++
+	if err == nil {
+		return
+	}
+	if errors.Is(err, errNotFound) {
+		rh.NotFound++
+	} else {
+		rh.Upstream++
+	}
+	rh.LastError = err.Error()
+}
+
+// missing records a client platform without a matching asset
+func (s *stats) missing(repo, platform string) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	rh := s.repoHealth(repo)
+	if rh == nil {
+		return
+	}
+	if rh.Missing == nil {
+		rh.Missing = map[string]int{}
+	}
+	rh.Missing[platform]++
+}
+
+// healthReport returns repo outcomes, optionally of a single
+// repo, with the most failing first
+func (s *stats) healthReport(repo string) []repoHealth {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	report := []repoHealth{}
+	for _, rh := range s.health {
+		if repo != "" && !strings.EqualFold(rh.Repo, repo) {
+			continue
+		}
+		c := *rh
+		if c.Requests > 0 {
+			c.ErrorRate = float64(c.NotFound+c.Upstream) / float64(c.Requests)
+		}
+		c.Missing = map[string]int{}
+		for p, n := range rh.Missing {
+			c.Missing[p] = n
+		}
+		report = append(report, c)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		a, b := report[i], report[j]
+		if a.ErrorRate != b.ErrorRate {
+			return a.ErrorRate > b.ErrorRate
+		}
+		if a.Requests != b.Requests {
+			return a.Requests > b.Requests
+		}
+		return a.Repo < b.Repo
+	})
+	return report
+}
+
+// load restores install counts saved to path
+func (s *stats) load(path string) error {
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	counts := []installCount{}
+	if err := json.Unmarshal(b, &counts); err != nil {
+		return err
+	}
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.installs = map[installKey]int{}
+	for _, c := range counts {
+		s.installs[c.installKey] += c.Installs
+	}
+	return nil
+}
+
+// save atomically writes install counts to path
+func (s *stats) save(path string) error {
+	b, err := json.Marshal(s.installCounts(""))
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o640); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// persistStats periodically saves install counts
+func (h *Handler) persistStats(path string) {
+	for range time.Tick(statsInterval) {
+		if err := h.stats.save(path); err != nil {
+			slog.Warn("saving stats failed", "err", err)
+		}
+	}
+}
+
+// clientPlatform guesses the client os and arch from a ?uname= hint
+// (e.g. "$(uname -s)-$(uname -m)"), falling back to its user agent
+func clientPlatform(r *http.Request) (string, string) {
+	hint := strings.ToLower(r.URL.Query().Get("uname"))
+	ua := strings.ToLower(r.UserAgent())
+	os := getOS(hint)
+	if os == "" {
+		switch {
+		case strings.Contains(ua, "linux"):
+			os = "linux"
+		case strings.Contains(ua, "darwin"), strings.Contains(ua, "mac os"), strings.Contains(ua, "macos"):
+			os = "darwin"
+		case strings.Contains(ua, "windows"):
+			os = "windows"
+		default:
+			os = "unknown"
+		}
+	}
+	arch := archRe.FindString(hint)
+	if arch == "" {
+		arch = archRe.FindString(ua)
+	}
+	switch {
+	case arch == "x86_64", arch == "" && (strings.Contains(ua, "x64") || strings.Contains(ua, "intel mac")):
+		arch = "amd64"
+	case arch == "aarch64":
+		arch = "arm64"
+	case arch == "i686":
+		arch = "386"
+	case arch == "":
+		arch = "unknown"
+	}
+	return os, arch
+}
+
+func (h *Handler) serveStats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, h.stats.installCounts(r.URL.Query().Get("repo")))
+}
+
+func (h *Handler) servePlatforms(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, h.stats.platformCounts())
+}
+
+func (h *Handler) serveHealthReport(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, h.stats.healthReport(r.URL.Query().Get("repo")))
+}
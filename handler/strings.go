@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"path"
 	"regexp"
 	"strings"
 )
@@ -10,6 +11,21 @@ var (
 	fileExtRe  = regexp.MustCompile(`(\.[a-z][a-z0-9]+)+$`)
 	posixOSRe  = regexp.MustCompile(`(darwin|linux|(net|free|open)bsd|mac|osx|windows|win)`)
 	checksumRe = regexp.MustCompile(`(checksums|sha256sums)`)
+	//values rendered into scripts must match these,
+	//which contain no shell meta characters
+	safeNameRe    = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+	safeAssetRe   = regexp.MustCompile(`^[A-Za-z0-9._+~@-]+$`)
+	safeReleaseRe = regexp.MustCompile(`^[A-Za-z0-9._+@/-]+$`)
+	safeDirRe     = regexp.MustCompile(`^~?/[A-Za-z0-9._/-]*$|^~$`)
+	safeURLRe     = regexp.MustCompile(`^https?://[A-Za-z0-9._~:/%+@=-]+$`)
+	safeProxyRe   = regexp.MustCompile(`^(https?|socks5h?)://[A-Za-z0-9._~:/%+@=-]+$`)
+	safeUpdateRe  = regexp.MustCompile(`^https?://[A-Za-z0-9._~:/%+@=[\]-]+\?[A-Za-z0-9._~%+=&-]+$`)
+	safeGlobRe    = regexp.MustCompile(`^[A-Za-z0-9._*?-]+$`)
+	safeArgsRe    = regexp.MustCompile(`^[A-Za-z0-9._=/ -]+$`)
+	safeTokenRe   = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+	safeCapsRe    = regexp.MustCompile(`^[a-z_,]+([=+-][eip]*)+( [a-z_,]+([=+-][eip]*)+)*$`)
+	sha256Re      = regexp.MustCompile(`^[a-fA-F0-9]{64}$`)
+	assetSuffixRe = regexp.MustCompile(`^(?i:v?[0-9]+(\.[0-9]+)*|darwin|linux|(net|free|open)bsd|macos|mac|osx|windows|win|x86_64|aarch64|i686|arm64|arm|386|amd64)([_.-]|$)`)
 )
 
 func getOS(s string) string {
@@ -42,6 +58,38 @@ func getFileExt(s string) string {
 	return fileExtRe.FindString(s)
 }
 
+// normalizeName strips the version, os and arch from an
+// asset-like name (e.g. tool_1.2.3_linux_amd64 is tool)
+func normalizeName(s string) string {
+	for i, r := range s {
+		if i > 0 && (r == '_' || r == '-') && assetSuffixRe.MatchString(s[i+1:]) {
+			return s[:i]
+		}
+	}
+	return s
+}
+
+// editDistance is the levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
 func splitHalf(s, by string) (string, string) {
 	i := strings.Index(s, by)
 	if i == -1 {
@@ -49,3 +97,29 @@ func splitHalf(s, by string) (string, string) {
 	}
 	return s[:i], s[i+len(by):]
 }
+
+// SplitList flattens comma separated items, allowing list
+// options to be set with repeated flags or a single env var
+func SplitList(items []string) []string {
+	out := []string{}
+	for _, item := range items {
+		for _, s := range strings.Split(item, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				out = append(out, s)
+			}
+		}
+	}
+	return out
+}
+
+// matchAny reports whether s matches any of the given glob
+// patterns, case-insensitively
+func matchAny(patterns []string, s string) bool {
+	s = strings.ToLower(s)
+	for _, p := range patterns {
+		if ok, _ := path.Match(strings.ToLower(p), s); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	suggestTimeout    = 3 * time.Second
+	suggestRetryAfter = time.Minute
+)
+
+// searches caches github repo searches, which
+// have a much smaller quota than the core api
+type searches struct {
+	mut     sync.Mutex
+	results map[string]search
+}
+
+type search struct {
+	repos   []string
+	expires time.Time
+}
+
+func (s *searches) get(program string) ([]string, bool) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	r, ok := s.results[program]
+	if !ok || time.Now().After(r.expires) {
+		return nil, false
+	}
+	return r.repos, true
+}
+
+func (s *searches) set(program string, repos []string, ttl time.Duration) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	if s.results == nil || len(s.results) >= maxBuckets {
+		s.results = map[string]search{}
+	}
+	s.results[program] = search{repos: repos, expires: time.Now().Add(ttl)}
+}
+
+// searchSuggestions returns the most popular github repos
+// named like a program which was not found
+func (h *Handler) searchSuggestions(ctx context.Context, program string) []string {
+	program = strings.ToLower(program)
+	if !h.Config.Suggest || !safeNameRe.MatchString(program) {
+		return nil
+	}
+	if repos, ok := h.searches.get(program); ok {
+		return repos
+	}
+	repos, err := h.searchRepos(ctx, program)
+	if err != nil {
+		slog.Debug("github search failed", "program", program, "err", err)
+		//failed searches are retried later, not per request
+		h.searches.set(program, nil, suggestRetryAfter)
+		return nil
+	}
+	h.searches.set(program, repos, h.Config.CacheTTL)
+	return repos
+}
+
+func (h *Handler) searchRepos(ctx context.Context, program string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, suggestTimeout)
+	defer cancel()
+	v := url.Values{}
+	v.Set("q", program+" in:name")
+	v.Set("sort", "stars")
+	v.Set("per_page", fmt.Sprint(maxSuggestions))
+	req, _ := http.NewRequestWithContext(ctx, "GET", h.apiURL()+"/search/repositories?"+v.Encode(), nil)
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	if h.Config.Token != "" {
+		req.Header.Set("Authorization", "token "+h.Config.Token)
+	}
+	//search has its own rate limit, which must
+	//not make the rest of the api back off
+	resp, err := h.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("search failed: %s", resp.Status)
+	}
+	result := struct {
+		Items []struct {
+			FullName string `json:"full_name"`
+		} `json:"items"`
+	}{}
+	if err := decodeJSON(resp.Body, &result); err != nil {
+		return nil, err
+	}
+	repos := []string{}
+	for _, item := range result.Items {
+		user, repo := splitHalf(item.FullName, "/")
+		if safeNameRe.MatchString(user) && safeNameRe.MatchString(repo) {
+			repos = append(repos, item.FullName)
+		}
+	}
+	return repos, nil
+}
@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+const tapPath = "/homebrew-tap"
+
+var formulaClassRe = regexp.MustCompile(`[-_.]([a-z0-9])`)
+
+// formulaClass is the class homebrew expects of a formula
+// file named name.rb (e.g. gh-dash is GhDash)
+func formulaClass(name string) string {
+	name = strings.ToLower(name)
+	name = formulaClassRe.ReplaceAllStringFunc(name, func(s string) string {
+		return strings.ToUpper(s[1:])
+	})
+	name = strings.ReplaceAll(name, "+", "x")
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// brewPlatform is an on_macos or on_linux block of a formula
+type brewPlatform struct {
+	Block  string
+	Arches []brewArch
+}
+
+// brewArch is an on_arm or on_intel block, or
+// neither when a single asset fits every mac
+type brewArch struct {
+	Block string
+	Asset
+}
+
+// brewPlatforms groups assets into homebrew's os and arch blocks,
+// where macs without arm64 assets use amd64 via rosetta
+func brewPlatforms(assets Assets) []brewPlatform {
+	platforms := []brewPlatform{}
+	for _, p := range []struct{ os, block string }{{"darwin", "on_macos"}, {"linux", "on_linux"}} {
+		var arm, intel *Asset
+		for i, a := range assets {
+			if a.OS != p.os {
+				continue
+			}
+			switch a.Arch {
+			case "arm64":
+				arm = &assets[i]
+			case "amd64":
+				intel = &assets[i]
+			}
+		}
+		bp := brewPlatform{Block: p.block}
+		if arm != nil {
+			bp.Arches = append(bp.Arches, brewArch{Block: "on_arm", Asset: *arm})
+		}
+		if intel != nil && arm == nil && p.os == "darwin" {
+			bp.Arches = append(bp.Arches, brewArch{Asset: *intel})
+		} else if intel != nil {
+			bp.Arches = append(bp.Arches, brewArch{Block: "on_intel", Asset: *intel})
+		}
+		if len(bp.Arches) > 0 {
+			platforms = append(platforms, bp)
+		}
+	}
+	return platforms
+}
+
+// serveTap serves a homebrew tap of Config.TapRepos as a git
+// repository, so users brew tap the server and upgrade normally
+func (h *Handler) serveTap(w http.ResponseWriter, r *http.Request) {
+	h.serveGit(w, r, &h.tap, tapPath, h.refreshTap)
+}
+
+// refreshTap renders a formula for each repo, where repos which fail
+// to resolve keep their previous formula rather than vanishing
+func (h *Handler) refreshTap(ctx context.Context) error {
+	ts, err := h.templates()
+	if err != nil {
+		return err
+	}
+	files := map[string][]byte{}
+	names := []string{}
+	for _, repo := range SplitList(h.Config.TapRepos) {
+		_, program := splitHalf(repo, "/")
+		name := strings.ToLower(program)
+		path := "Formula/" + name + ".rb"
+		formula, err := h.formula(ctx, ts.Lookup("tap"), repo)
+		if err != nil {
+			slog.Warn("homebrew tap formula failed", "repo", repo, "err", err)
+			prev, ok := h.tap.file(path)
+			if !ok {
+				continue
+			}
+			formula = prev
+		}
+		files[path] = formula
+		names = append(names, name)
+	}
+	files["README.md"] = gitReadme("homebrew tap", h.Config.TapRepos)
+	h.tap.update(files, "Update "+strings.Join(names, ", "))
+	return nil
+}
+
+// formula renders the formula of repo with t
+func (h *Handler) formula(ctx context.Context, t *template.Template, repo string) ([]byte, error) {
+	result, err := h.resolveRepo(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+	if result, err = h.finish(result); err != nil {
+		return nil, err
+	}
+	if len(brewPlatforms(result.Assets)) == 0 {
+		return nil, errors.New("no mac or linux assets")
+	}
+	buff := bytes.Buffer{}
+	if err := t.Execute(&buff, result); err != nil {
+		return nil, err
+	}
+	return buff.Bytes(), nil
+}
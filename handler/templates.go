@@ -0,0 +1,170 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/jpillora/installer/scripts"
+)
+
+// templateFiles are named by response type, so
+// templates may include one another
+var templateFiles = []struct {
+	name, file string
+	embedded   []byte
+}{
+	{"script", "install.sh.tmpl", scripts.Shell},
+	{"posix", "install.posix.sh.tmpl", scripts.Posix},
+	{"powershell", "install.ps1.tmpl", scripts.PowerShell},
+	{"homebrew", "install.rb.tmpl", scripts.Homebrew},
+	{"text", "install.txt.tmpl", scripts.Text},
+	{"uninstall", "uninstall.sh.tmpl", scripts.Uninstall},
+	{"offline", "offline.txt.tmpl", scripts.Offline},
+	{"tap", "tap.rb.tmpl", scripts.Tap},
+	{"error-script", "error.sh.tmpl", scripts.ErrorShell},
+	{"error-text", "error.txt.tmpl", scripts.ErrorText},
+}
+
+var psQuoteRe = regexp.MustCompile("['\u2018\u2019\u201a\u201b]")
+
+// templateFuncs are available to all templates
+var templateFuncs = template.FuncMap{
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	//quote for a posix shell
+	"quote": func(s string) string {
+		return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+	},
+	//quote for powershell, which also ends strings at curly quotes
+	"psquote": func(s string) string {
+		return "'" + psQuoteRe.ReplaceAllString(s, "$0$0") + "'"
+	},
+	"default": func(def string, s string) string {
+		if s == "" {
+			return def
+		}
+		return s
+	},
+	"semverCompare": semverCompare,
+	"trimPrefix": func(prefix, s string) string {
+		return strings.TrimPrefix(s, prefix)
+	},
+	"formulaClass":  formulaClass,
+	"brewPlatforms": brewPlatforms,
+}
+
+var defaultTemplates = sync.OnceValues(func() (*template.Template, error) {
+	return parseTemplates(func(name string, embedded []byte) string {
+		return string(embedded)
+	})
+})
+
+// templates returns the response templates, re-read from
+// the template directory on every call when set
+func (h *Handler) templates() (*template.Template, error) {
+	if h.Config.TemplateDir == "" {
+		return defaultTemplates()
+	}
+	return parseTemplates(h.script)
+}
+
+func parseTemplates(load func(file string, embedded []byte) string) (*template.Template, error) {
+	t := template.New("installer").Funcs(templateFuncs)
+	for _, f := range templateFiles {
+		if _, err := t.New(f.name).Parse(load(f.file, f.embedded)); err != nil {
+			return nil, fmt.Errorf("%s: %w", f.file, err)
+		}
+	}
+	return t, nil
+}
+
+var defaultErrorHTML = sync.OnceValues(func() (*htmltemplate.Template, error) {
+	return parseErrorHTML(string(scripts.ErrorHTML))
+})
+
+// errorHTML returns the html error page, parsed with html/template
+// so the fields it shows are escaped for html, unlike scripts
+func (h *Handler) errorHTML() (*htmltemplate.Template, error) {
+	if h.Config.TemplateDir == "" {
+		return defaultErrorHTML()
+	}
+	return parseErrorHTML(h.script("error.html.tmpl", scripts.ErrorHTML))
+}
+
+func parseErrorHTML(text string) (*htmltemplate.Template, error) {
+	t, err := htmltemplate.New("error-html").Funcs(htmltemplate.FuncMap(templateFuncs)).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("error.html.tmpl: %w", err)
+	}
+	return t, nil
+}
+
+// script returns the named template from the template
+// directory when present, otherwise the embedded default
+func (h *Handler) script(name string, embedded []byte) string {
+	b, err := os.ReadFile(filepath.Join(h.Config.TemplateDir, name))
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			slog.Warn("template override failed, using default", "template", name, "err", err)
+		}
+		return string(embedded)
+	}
+	return string(b)
+}
+
+// semverCompare returns -1, 0 or 1 when version a is older, the
+// same or newer than b, ignoring any v prefix and build metadata
+func semverCompare(a, b string) int {
+	pa, pb := parseSemver(a), parseSemver(b)
+	for i := 0; i < 3; i++ {
+		if pa.parts[i] != pb.parts[i] {
+			if pa.parts[i] < pb.parts[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	//pre-releases precede their release
+	switch {
+	case pa.pre == pb.pre:
+		return 0
+	case pa.pre == "":
+		return 1
+	case pb.pre == "":
+		return -1
+	case pa.pre < pb.pre:
+		return -1
+	}
+	return 1
+}
+
+type semver struct {
+	parts [3]int
+	pre   string
+}
+
+func parseSemver(v string) semver {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	v, _, _ = strings.Cut(v, "+")
+	v, pre, _ := strings.Cut(v, "-")
+	s := semver{pre: pre}
+	for i, p := range strings.SplitN(v, ".", 3) {
+		s.parts[i], _ = strconv.Atoi(p)
+	}
+	return s
+}
@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const defaultHome = "https://github.com/jpillora/installer"
+
+// Tenant overrides settings for requests to a host, so a
+// single server can act as several branded installers
+type Tenant struct {
+	User      string //default user
+	ForceUser string
+	ForceRepo string
+	Home      string //linked from text responses, and where / redirects
+	Banner    string //shown atop generated scripts
+}
+
+// force splits a ForceUser or ForceRepo setting into a single
+// literal, which replaces the requested value, or a list of glob
+// patterns, which the requested value must match
+func force(setting string) (string, []string) {
+	patterns := SplitList([]string{setting})
+	if len(patterns) == 1 && !strings.ContainsAny(patterns[0], "*?[") {
+		return patterns[0], nil
+	}
+	return "", patterns
+}
+
+// permits reports whether q matches the force patterns
+func (t Tenant) permits(q Query) bool {
+	if _, users := force(t.ForceUser); len(users) > 0 && !matchAny(users, q.User) {
+		return false
+	}
+	if _, repos := force(t.ForceRepo); len(repos) > 0 && !matchAny(repos, q.Program) {
+		return false
+	}
+	return true
+}
+
+// bannerLines splits a banner on newlines, or on
+// literal \n sequences which are easier to set in env vars
+func bannerLines(banner string) []string {
+	banner = strings.TrimRight(strings.ReplaceAll(banner, `\n`, "\n"), "\n")
+	if banner == "" {
+		return nil
+	}
+	return strings.Split(banner, "\n")
+}
+
+// subdomain returns the user/repo target encoded in a
+// subdomain of the configured base, as repo or user--repo
+func (h *Handler) subdomain(r *http.Request) (string, bool) {
+	base := strings.ToLower(strings.Trim(h.Config.SubdomainBase, "."))
+	if base == "" {
+		return "", false
+	}
+	label, ok := strings.CutSuffix(requestHost(r), "."+base)
+	if !ok || label == "" || strings.Contains(label, ".") {
+		return "", false
+	}
+	//github users can't contain double dashes
+	user, repo, ok := strings.Cut(label, "--")
+	if !ok {
+		return label, true
+	}
+	return user + "/" + repo, true
+}
+
+// requestHost is the lowercase host of r, without a port
+func requestHost(r *http.Request) string {
+	host := r.Host
+	if hp, _, err := net.SplitHostPort(host); err == nil {
+		host = hp
+	}
+	return strings.ToLower(host)
+}
+
+// tenant returns the settings for the request's host, matched
+// exactly or else by the first matching glob pattern
+func (h *Handler) tenant(r *http.Request) Tenant {
+	t := Tenant{
+		User:      h.Config.User,
+		ForceUser: h.Config.ForceUser,
+		ForceRepo: h.Config.ForceRepo,
+		Home:      defaultHome,
+		Banner:    h.Config.Banner,
+	}
+	if len(h.Config.Tenants) == 0 {
+		return t
+	}
+	host := requestHost(r)
+	o, ok := h.Config.Tenants[host]
+	if !ok {
+		patterns := make([]string, 0, len(h.Config.Tenants))
+		for p := range h.Config.Tenants {
+			patterns = append(patterns, p)
+		}
+		sort.Strings(patterns)
+		for _, p := range patterns {
+			if matchAny([]string{p}, host) {
+				o, ok = h.Config.Tenants[p], true
+				break
+			}
+		}
+	}
+	if !ok {
+		return t
+	}
+	if o.User != "" {
+		t.User = o.User
+	}
+	if o.ForceUser != "" {
+		t.ForceUser = o.ForceUser
+	}
+	if o.ForceRepo != "" {
+		t.ForceRepo = o.ForceRepo
+	}
+	if o.Home != "" {
+		t.Home = o.Home
+	}
+	if o.Banner != "" {
+		t.Banner = o.Banner
+	}
+	return t
+}
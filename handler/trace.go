@@ -0,0 +1,34 @@
+package handler
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer uses the globally registered provider,
+// which is a no-op unless the program configures tracing
+var tracer = otel.Tracer("github.com/jpillora/installer/handler")
+
+// tracedTransport records a client span for each upstream request
+func tracedTransport(rt http.RoundTripper) http.RoundTripper {
+	return otelhttp.NewTransport(rt,
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			return r.Method + " " + r.URL.Host
+		}),
+	)
+}
+
+// traceQuery annotates the current request span with the resolved query
+func traceQuery(r *http.Request, q Query, qtype string) {
+	trace.SpanFromContext(r.Context()).SetAttributes(
+		attribute.String("installer.user", q.User),
+		attribute.String("installer.program", q.Program),
+		attribute.String("installer.release", q.Release),
+		attribute.String("installer.type", qtype),
+		attribute.String("installer.request_id", requestID(r.Context())),
+	)
+}
@@ -0,0 +1,29 @@
+package handler
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// updateURL is where a <program>-update helper fetches the upgrade
+// script of q from, keeping the options of r which still apply
+func (h *Handler) updateURL(r *http.Request, q Query) string {
+	u := url.URL{Scheme: "http", Host: r.Host, Path: strings.TrimSuffix(h.Prefix, "/") + "/" + q.User + "/" + q.Program}
+	if r.TLS != nil || (h.Config.TrustProxy && r.Header.Get("X-Forwarded-Proto") == "https") {
+		u.Scheme = "https"
+	}
+	//the subdomain already identifies the repo
+	if _, ok := h.subdomain(r); ok {
+		u.Path = strings.TrimSuffix(h.Prefix, "/") + "/"
+	}
+	v := r.URL.Query()
+	//upgrades happen in place, always to the latest release
+	for _, k := range []string{"helper", "force", "dryrun", "debug", "dir", "move", "addpath", "expect_sha256"} {
+		v.Del(k)
+	}
+	v.Set("type", "script")
+	v.Set("upgrade", "1")
+	u.RawQuery = v.Encode()
+	return u.String()
+}
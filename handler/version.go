@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"net/http"
+	"runtime"
+	"runtime/debug"
+)
+
+// Commit of the installer build, defaults to the vcs revision stamped by go build
+var Commit = ""
+
+// buildInfo identifies this build and the features it has enabled
+type buildInfo struct {
+	Version   string   `json:"version"`
+	Commit    string   `json:"commit,omitempty"`
+	GoVersion string   `json:"go_version"`
+	Providers []string `json:"providers"`
+	Cache     string   `json:"cache"`
+	Features  []string `json:"features"`
+}
+
+func (h *Handler) serveVersion(w http.ResponseWriter, r *http.Request) {
+	info := buildInfo{
+		Version:   Version,
+		Commit:    Commit,
+		GoVersion: runtime.Version(),
+		Providers: []string{"github"},
+		Cache:     "memory",
+		Features:  h.features(),
+	}
+	if info.Commit == "" {
+		if bi, ok := debug.ReadBuildInfo(); ok {
+			for _, s := range bi.Settings {
+				if s.Key == "vcs.revision" {
+					info.Commit = s.Value
+				}
+			}
+		}
+	}
+	writeJSON(w, info)
+}
+
+// features lists enabled options, without revealing their values
+func (h *Handler) features() []string {
+	c := h.Config
+	fs := []string{}
+	add := func(name string, enabled bool) {
+		if enabled {
+			fs = append(fs, name)
+		}
+	}
+	add("api-mirror", c.APIURL != "")
+	add("token", c.Token != "")
+	add("token-passthrough", c.Passthrough)
+	add("force-repo", c.ForceUser != "" || c.ForceRepo != "")
+	add("allowlist", len(c.AllowUsers) > 0 || len(c.DenyRepos) > 0)
+	add("popularity-guard", c.MinStars > 0 || c.MinRepoAge > 0)
+	add("https-only", c.HTTPSOnly)
+	add("require-checksums", c.RequireChecksums)
+	add("signing", h.signer != nil)
+	add("api-keys", len(c.APIKeys) > 0)
+	add("admin", c.AdminPassword != "" || h.oidc != nil)
+	add("cors", len(c.CORSOrigins) > 0)
+	add("audit-log", h.Audit != nil)
+	add("access-log", h.accessLog != nil)
+	add("privacy", c.Privacy)
+	add("rate-limit", c.RateLimit > 0 || c.RepoLimit > 0)
+	add("org-quotas", len(h.quotas) > 0)
+	add("proxy", c.ProxyURL != "")
+	add("tls", len(c.ACMEDomains) > 0)
+	add("tracing", c.OTLPEndpoint != "")
+	return fs
+}
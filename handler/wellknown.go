@@ -0,0 +1,58 @@
+package handler
+
+import (
+	_ "embed"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+//go:embed favicon.png
+var favicon []byte
+
+// crawlers following links would burn through the github quota
+const defaultRobots = "User-agent: *\nDisallow: /\n"
+
+// serveWellKnown answers paths which clients request by
+// convention, instead of treating them as repo lookups
+func (h *Handler) serveWellKnown(w http.ResponseWriter, r *http.Request) bool {
+	switch r.URL.Path {
+	case "/robots.txt":
+		robots := []byte(defaultRobots)
+		if h.Config.RobotsFile != "" {
+			b, err := os.ReadFile(h.Config.RobotsFile)
+			if err != nil {
+				http.Error(w, "robots.txt unavailable", http.StatusInternalServerError)
+				return true
+			}
+			robots = b
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write(robots)
+	case "/favicon.ico":
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Cache-Control", "public, max-age=604800")
+		w.Write(favicon)
+	case "/.well-known/security.txt":
+		contacts := SplitList(h.Config.SecurityContacts)
+		if len(contacts) == 0 {
+			http.NotFound(w, r)
+			return true
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for _, c := range contacts {
+			if !strings.Contains(c, ":") {
+				c = "mailto:" + c
+			}
+			fmt.Fprintf(w, "Contact: %s\n", c)
+		}
+		//regenerated on each request, so never actually expires
+		expires := time.Now().UTC().AddDate(0, 0, 30).Truncate(24 * time.Hour)
+		fmt.Fprintf(w, "Expires: %s\n", expires.Format(time.RFC3339))
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,272 @@
+package installer
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Platform returns the asset of result for this platform
+func Platform(result Result) (Asset, error) {
+	return PlatformOf(result, runtime.GOOS, runtime.GOARCH)
+}
+
+// PlatformOf returns the asset of result for goos/goarch, where macs
+// and windows without arm64 assets fall back to amd64 (via rosetta
+// or emulation) as scripts do
+func PlatformOf(result Result, goos, goarch string) (Asset, error) {
+	assets := result.Assets
+	if goos == "windows" {
+		assets = result.Windows
+	}
+	for _, arch := range []string{goarch, "amd64"} {
+		for _, a := range assets {
+			if a.OS == goos && a.Arch == arch {
+				return a, nil
+			}
+		}
+		if goos != "darwin" && goos != "windows" {
+			break
+		}
+	}
+	return Asset{}, fmt.Errorf("no asset for platform %s/%s", goos, goarch)
+}
+
+// platform is the os and arch installed by r
+func (r *Resolver) platform() (string, string) {
+	goos, goarch := r.OS, r.Arch
+	if goos == "" {
+		goos = runtime.GOOS
+	}
+	if goarch == "" {
+		goarch = runtime.GOARCH
+	}
+	return goos, goarch
+}
+
+// Platform returns the asset of result installed by r
+func (r *Resolver) Platform(result Result) (Asset, error) {
+	goos, goarch := r.platform()
+	return PlatformOf(result, goos, goarch)
+}
+
+// Install downloads the asset of result for this platform, verifies
+// its checksum when published, and moves its binary (the largest
+// file of an archive) into dir as name, defaulting to the program
+// name, returning the installed path
+func (r *Resolver) Install(ctx context.Context, result Result, dir, name string) (string, error) {
+	a, err := r.Platform(result)
+	if err != nil {
+		return "", err
+	}
+	//windows assets skip the server's checksum policy
+	if result.RequireChecksum && a.SHA256 == "" {
+		return "", fmt.Errorf("no published checksum for %s", a.Name)
+	}
+	if name == "" {
+		name = result.Program
+		if result.AsProgram != "" {
+			name = result.AsProgram
+		}
+	}
+	if goos, _ := r.platform(); goos == "windows" && !strings.HasSuffix(strings.ToLower(name), ".exe") {
+		name += ".exe"
+	}
+	tmp, err := os.MkdirTemp("", "jpillora-installer-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+	//download, then verify before extracting
+	archive := filepath.Join(tmp, "asset"+a.Type)
+	if err := r.download(ctx, result, a, archive); err != nil {
+		return "", fmt.Errorf("download failed: %w", err)
+	}
+	bin := filepath.Join(tmp, "bin")
+	if err := extract(archive, a.Type, bin); err != nil {
+		return "", fmt.Errorf("extract failed: %w", err)
+	}
+	//move beside the destination first, so the final
+	//rename is atomic and never leaves a partial binary
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	dest := filepath.Join(dir, name)
+	staged := dest + ".installing"
+	if err := copyFile(bin, staged); err != nil {
+		os.Remove(staged)
+		return "", err
+	}
+	if err := os.Rename(staged, dest); err != nil {
+		os.Remove(staged)
+		return "", err
+	}
+	return dest, nil
+}
+
+// Install installs result with the default configuration
+func Install(ctx context.Context, result Result, dir, name string) (string, error) {
+	return defaultResolver().Install(ctx, result, dir, name)
+}
+
+func (r *Resolver) download(ctx context.Context, result Result, a Asset, path string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.URL, nil)
+	if err != nil {
+		return err
+	}
+	//private release, assets are downloaded via the github api
+	if result.Private {
+		req.Header.Set("Accept", "application/octet-stream")
+	}
+	if token := r.h.Config.Token; token != "" {
+		req.Header.Set("Authorization", "token "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", a.URL, resp.Status)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(f, hash), resp.Body); err != nil {
+		return err
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); a.SHA256 != "" && !strings.EqualFold(sum, a.SHA256) {
+		return fmt.Errorf("checksum mismatch, expected sha256 %s, got %s", a.SHA256, sum)
+	}
+	return f.Close()
+}
+
+// extract writes the binary of the archive at path to bin
+func extract(path, ftype, bin string) error {
+	switch ftype {
+	case ".bin", ".exe":
+		return os.Rename(path, bin)
+	case ".gz":
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		return writeFile(bin, gz)
+	case ".tar.gz", ".tgz":
+		//find the largest file, then extract it
+		largest := ""
+		size := int64(-1)
+		err := walkTar(path, func(h *tar.Header, _ io.Reader) error {
+			if h.Size > size {
+				largest, size = h.Name, h.Size
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if largest == "" {
+			return errors.New("empty archive")
+		}
+		return walkTar(path, func(h *tar.Header, r io.Reader) error {
+			if h.Name != largest {
+				return nil
+			}
+			largest = ""
+			return writeFile(bin, r)
+		})
+	case ".zip":
+		z, err := zip.OpenReader(path)
+		if err != nil {
+			return err
+		}
+		defer z.Close()
+		var largest *zip.File
+		for _, f := range z.File {
+			if !f.FileInfo().Mode().IsRegular() {
+				continue
+			}
+			if largest == nil || f.UncompressedSize64 > largest.UncompressedSize64 {
+				largest = f
+			}
+		}
+		if largest == nil {
+			return errors.New("empty archive")
+		}
+		rc, err := largest.Open()
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		return writeFile(bin, rc)
+	}
+	return fmt.Errorf("unknown file type: %s", ftype)
+}
+
+// walkTar calls fn with each regular file of a gzipped tarball
+func walkTar(path string, fn func(*tar.Header, io.Reader) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := fn(h, tr); err != nil {
+			return err
+		}
+	}
+}
+
+func writeFile(path string, r io.Reader) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o755)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func copyFile(src, dst string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return writeFile(dst, f)
+}
@@ -0,0 +1,83 @@
+// Package installer resolves the Github release assets which
+// installer scripts download, so other Go programs (e.g. release
+// dashboards or CLIs) can reuse its asset selection without
+// running the HTTP server
+package installer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/jpillora/installer/handler"
+)
+
+type (
+	Query  = handler.Query
+	Result = handler.Result
+	Asset  = handler.Asset
+	Assets = handler.Assets
+	Config = handler.Config
+)
+
+// Resolver resolves releases with its own configuration and cache
+type Resolver struct {
+	h *handler.Handler
+	//OS and Arch select the platform installed,
+	//defaulting to this one
+	OS, Arch string
+}
+
+// NewResolver returns a resolver using c, e.g. handler.DefaultConfig
+// with a Token
+func NewResolver(c Config) *Resolver {
+	return &Resolver{h: &handler.Handler{Config: c}}
+}
+
+// Resolve finds the release of q.User/q.Program (the latest unless
+// q.Release is set) and its assets for each platform
+func (r *Resolver) Resolve(ctx context.Context, q Query) (Result, error) {
+	return r.h.Resolve(ctx, q)
+}
+
+var defaultResolver = sync.OnceValue(func() *Resolver {
+	c := handler.DefaultConfig
+	c.Token = os.Getenv("GITHUB_TOKEN")
+	return NewResolver(c)
+})
+
+// Resolve resolves q with the default configuration, authenticated
+// with GITHUB_TOKEN when set
+func Resolve(ctx context.Context, q Query) (Result, error) {
+	return defaultResolver().Resolve(ctx, q)
+}
+
+// Render writes the named script template (script, posix, homebrew,
+// text, uninstall or offline) for result
+func (r *Resolver) Render(w io.Writer, result Result, template string) error {
+	return r.h.Render(w, result, template)
+}
+
+// Only restricts result to the asset of a single platform, where
+// an empty goos or goarch matches any
+func Only(result Result, goos, goarch string) (Result, error) {
+	assets := Assets{}
+	for _, a := range result.Assets {
+		if (goos == "" || a.OS == goos) && (goarch == "" || a.Arch == goarch) {
+			assets = append(assets, a)
+		}
+	}
+	if len(assets) == 0 {
+		return result, fmt.Errorf("no asset for platform %s/%s", goos, goarch)
+	}
+	result.Assets = assets
+	result.M1Asset = false
+	for _, a := range assets {
+		if a.IsMacM1() {
+			result.M1Asset = true
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,117 @@
+package installer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jpillora/installer/scripts"
+)
+
+var siteTemplates = template.Must(template.Must(template.Must(
+	template.New("page").Parse(string(scripts.Page))).
+	New("index").Parse(string(scripts.Index))).
+	New("badge").Parse(string(scripts.Badge)))
+
+type sitePage struct {
+	Result
+	URL       string
+	Generated string
+}
+
+type siteBadge struct {
+	Label, Release                  string
+	Width, LabelWidth, ReleaseWidth int
+	LabelX, ReleaseX                float64
+}
+
+// Generate writes a static site to dir, served from baseURL (e.g. a
+// github pages or s3 bucket url), with each of the queries as
+//
+//	<user>/<repo>           bash script
+//	<user>/<repo>.posix.sh  posix script
+//	<user>/<repo>.rb        homebrew formula
+//	<user>/<repo>.txt       text summary
+//	<user>/<repo>.json      json result
+//	<user>/<repo>.svg       release badge
+//	<user>/<repo>.html      page with install commands
+//
+// and an index.html linking each page, so small projects need
+// no running server. Scripts install the resolved releases, so
+// sites should be regenerated when the repos release.
+func (r *Resolver) Generate(ctx context.Context, dir, baseURL string, queries []Query) error {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	generated := time.Now().UTC().Format(time.RFC3339)
+	pages := []sitePage{}
+	for _, q := range queries {
+		result, err := r.Resolve(ctx, q)
+		if err != nil {
+			return fmt.Errorf("%s/%s: %w", q.User, q.Program, err)
+		}
+		result.Home = baseURL
+		page := sitePage{Result: result, URL: baseURL, Generated: generated}
+		if err := r.generatePage(dir, page); err != nil {
+			return fmt.Errorf("%s/%s: %w", q.User, q.Program, err)
+		}
+		pages = append(pages, page)
+	}
+	buff := bytes.Buffer{}
+	err := siteTemplates.ExecuteTemplate(&buff, "index", struct {
+		Pages     []sitePage
+		Generated string
+	}{pages, generated})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "index.html"), buff.Bytes(), 0o644)
+}
+
+func (r *Resolver) generatePage(dir string, page sitePage) error {
+	base := filepath.Join(dir, page.User, page.Program)
+	if err := os.MkdirAll(filepath.Dir(base), 0o755); err != nil {
+		return err
+	}
+	files := map[string]func(*bytes.Buffer) error{}
+	for ext, tmpl := range map[string]string{"": "script", ".posix.sh": "posix", ".rb": "homebrew", ".txt": "text"} {
+		tmpl := tmpl
+		files[ext] = func(b *bytes.Buffer) error { return r.Render(b, page.Result, tmpl) }
+	}
+	files[".json"] = func(b *bytes.Buffer) error {
+		enc := json.NewEncoder(b)
+		enc.SetIndent("", "  ")
+		return enc.Encode(page.Result)
+	}
+	files[".svg"] = func(b *bytes.Buffer) error {
+		return siteTemplates.ExecuteTemplate(b, "badge", badge(page.Program, page.Release))
+	}
+	files[".html"] = func(b *bytes.Buffer) error {
+		return siteTemplates.ExecuteTemplate(b, "page", page)
+	}
+	for ext, render := range files {
+		buff := bytes.Buffer{}
+		if err := render(&buff); err != nil {
+			return fmt.Errorf("%s: %w", ext, err)
+		}
+		if err := os.WriteFile(base+ext, buff.Bytes(), 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// badge sizes a flat badge, with text roughly 7px per character
+func badge(label, release string) siteBadge {
+	b := siteBadge{Label: label, Release: release}
+	b.LabelWidth = 7*len(label) + 10
+	b.ReleaseWidth = 7*len(release) + 10
+	b.Width = b.LabelWidth + b.ReleaseWidth
+	b.LabelX = float64(b.LabelWidth) / 2
+	b.ReleaseX = float64(b.LabelWidth) + float64(b.ReleaseWidth)/2
+	return b
+}
@@ -0,0 +1,205 @@
+// Package lambda runs an http.Handler as an AWS Lambda function,
+// behind API Gateway (REST or HTTP APIs) or a function URL, using
+// the Lambda runtime API directly, without the AWS SDK.
+package lambda
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Event is an API Gateway proxy event, in payload format
+// 1.0 (REST APIs) or 2.0 (HTTP APIs and function URLs)
+type Event struct {
+	Version string `json:"version"`
+	//1.0
+	HTTPMethod            string              `json:"httpMethod"`
+	Path                  string              `json:"path"`
+	MultiValueHeaders     map[string][]string `json:"multiValueHeaders"`
+	MultiValueQueryParams map[string][]string `json:"multiValueQueryStringParameters"`
+	//2.0
+	RawPath        string   `json:"rawPath"`
+	RawQueryString string   `json:"rawQueryString"`
+	Cookies        []string `json:"cookies"`
+	//both
+	Headers         map[string]string `json:"headers"`
+	Body            string            `json:"body"`
+	IsBase64Encoded bool              `json:"isBase64Encoded"`
+	RequestContext  struct {
+		DomainName string `json:"domainName"`
+		Identity   struct {
+			SourceIP string `json:"sourceIp"`
+		} `json:"identity"`
+		HTTP struct {
+			Method   string `json:"method"`
+			SourceIP string `json:"sourceIp"`
+		} `json:"http"`
+	} `json:"requestContext"`
+}
+
+// Response is an API Gateway proxy response, understood by both
+// payload formats
+type Response struct {
+	StatusCode        int                 `json:"statusCode"`
+	Headers           map[string]string   `json:"headers,omitempty"`
+	MultiValueHeaders map[string][]string `json:"multiValueHeaders,omitempty"`
+	Cookies           []string            `json:"cookies,omitempty"`
+	Body              string              `json:"body"`
+	IsBase64Encoded   bool                `json:"isBase64Encoded"`
+}
+
+// Request translates e into an http request
+func (e Event) Request(ctx context.Context) (*http.Request, error) {
+	v2 := e.Version == "2.0"
+	method, path, query, ip := e.HTTPMethod, e.Path, "", e.RequestContext.Identity.SourceIP
+	if v2 {
+		method, path, query, ip = e.RequestContext.HTTP.Method, e.RawPath, e.RawQueryString, e.RequestContext.HTTP.SourceIP
+	} else {
+		q := url.Values{}
+		for k, vs := range e.MultiValueQueryParams {
+			q[k] = vs
+		}
+		query = q.Encode()
+	}
+	if method == "" || path == "" {
+		return nil, errors.New("not an api gateway proxy event")
+	}
+	body := []byte(e.Body)
+	if e.IsBase64Encoded {
+		var err error
+		if body, err = base64.StdEncoding.DecodeString(e.Body); err != nil {
+			return nil, fmt.Errorf("invalid body: %w", err)
+		}
+	}
+	u := &url.URL{Path: path, RawQuery: query}
+	r, err := http.NewRequestWithContext(ctx, method, u.RequestURI(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, vs := range e.MultiValueHeaders {
+		for _, v := range vs {
+			r.Header.Add(k, v)
+		}
+	}
+	for k, v := range e.Headers {
+		if r.Header.Get(k) == "" {
+			r.Header.Set(k, v)
+		}
+	}
+	if len(e.Cookies) > 0 {
+		r.Header.Set("Cookie", strings.Join(e.Cookies, "; "))
+	}
+	r.Host = r.Header.Get("Host")
+	if r.Host == "" {
+		r.Host = e.RequestContext.DomainName
+	}
+	r.RemoteAddr = net.JoinHostPort(ip, "0")
+	r.RequestURI = u.RequestURI()
+	return r, nil
+}
+
+// Handle serves the event payload with h, returning the response payload
+func Handle(ctx context.Context, h http.Handler, payload []byte) ([]byte, error) {
+	e := Event{}
+	if err := json.Unmarshal(payload, &e); err != nil {
+		return nil, err
+	}
+	r, err := e.Request(ctx)
+	if err != nil {
+		return nil, err
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	resp := Response{
+		StatusCode:        w.Code,
+		Headers:           map[string]string{},
+		MultiValueHeaders: map[string][]string{},
+	}
+	for k, vs := range w.Result().Header {
+		if k == "Set-Cookie" && e.Version == "2.0" {
+			resp.Cookies = vs
+			continue
+		}
+		resp.Headers[k] = strings.Join(vs, ",")
+		resp.MultiValueHeaders[k] = vs
+	}
+	//payload format 2.0 rejects both header fields
+	if e.Version == "2.0" {
+		resp.MultiValueHeaders = nil
+	} else {
+		resp.Headers = nil
+	}
+	body := w.Body.Bytes()
+	if utf8.Valid(body) {
+		resp.Body = string(body)
+	} else {
+		resp.Body = base64.StdEncoding.EncodeToString(body)
+		resp.IsBase64Encoded = true
+	}
+	return json.Marshal(resp)
+}
+
+// Serve processes invocations from the lambda runtime api
+// at api (AWS_LAMBDA_RUNTIME_API), until it fails
+func Serve(api string, h http.Handler) error {
+	base := "http://" + api + "/2018-06-01/runtime/invocation/"
+	for {
+		if err := invoke(base, h); err != nil {
+			return err
+		}
+	}
+}
+
+// invoke waits for the next invocation, and posts its response
+func invoke(base string, h http.Handler) error {
+	resp, err := http.Get(base + "next")
+	if err != nil {
+		return err
+	}
+	payload, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("runtime api: %s", resp.Status)
+	}
+	id := resp.Header.Get("Lambda-Runtime-Aws-Request-Id")
+	ctx := context.Background()
+	if ms, err := strconv.ParseInt(resp.Header.Get("Lambda-Runtime-Deadline-Ms"), 10, 64); err == nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, time.UnixMilli(ms))
+		defer cancel()
+	}
+	out, err := Handle(ctx, h, payload)
+	if err != nil {
+		out, _ = json.Marshal(map[string]string{"errorMessage": err.Error(), "errorType": "InvalidEvent"})
+		return post(base+id+"/error", out)
+	}
+	return post(base+id+"/response", out)
+}
+
+func post(url string, body []byte) error {
+	resp, err := http.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("runtime api: %s", resp.Status)
+	}
+	return nil
+}
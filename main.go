@@ -1,51 +1,193 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
-	"log"
+	"log/slog"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/jpillora/installer/handler"
+	"github.com/jpillora/installer/lambda"
 	"github.com/jpillora/opts"
-	"github.com/jpillora/requestlog"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"golang.org/x/crypto/acme/autocert"
 )
 
-var version = "0.0.0-src"
+var (
+	version = "0.0.0-src"
+	commit  = ""
+)
 
 func main() {
+	handler.Version = version
+	handler.Commit = commit
 	c := handler.DefaultConfig
-	opts.New(&c).Repo("github.com/jpillora/installer").Version(version).Parse()
-	log.Printf("default user is '%s'", c.User)
+	p := opts.New(&c).Repo("github.com/jpillora/installer").Version(version).
+		AddCommand(opts.New(&getCmd{}).Name("get").Summary("install a release natively, without a shell script")).
+		AddCommand(opts.New(&renderCmd{}).Name("render").Summary("print a pinned install script, to vendor into a repo")).
+		AddCommand(opts.New(&generateCmd{}).Name("generate").Summary("pre-render a static site of scripts for a list of repos")).
+		Parse()
+	if p.IsRunnable() {
+		p.RunFatal()
+		return
+	}
 	if c.Token == "" && os.Getenv("GH_TOKEN") != "" {
 		c.Token = os.Getenv("GH_TOKEN") // GH_TOKEN was renamed
 	}
+	c, err := handler.ReadConfigFile(c)
+	if err != nil {
+		fatal("config file failed", "err", err)
+	}
+	level, err := logger(c)
+	if err != nil {
+		fatal("invalid log options", "err", err)
+	}
+	slog.Info("default user", "user", c.User)
+	api := "api.github.com"
+	if c.APIURL != "" {
+		api = c.APIURL
+		slog.Info("using github api mirror", "url", api)
+	}
 	if c.Token != "" {
-		log.Printf("github token will be used for requests to api.github.com")
+		slog.Info("github token will be used", "api", api)
+	}
+	if c.Passthrough {
+		slog.Info("client supplied github tokens will be forwarded", "api", api)
 	}
 	if c.ForceUser != "" {
-		log.Printf("locked user to '%s'", c.ForceUser)
+		slog.Info("locked user", "user", c.ForceUser)
 	}
 	if c.ForceRepo != "" {
-		log.Printf("locked repo to '%s'", c.ForceRepo)
+		slog.Info("locked repo", "repo", c.ForceRepo)
+	}
+	if c.OIDCIssuer != "" && len(handler.SplitList(c.OIDCSubjects)) == 0 {
+		fatal("oidc admin requires subjects, any account of the issuer could otherwise sign in", "issuer", c.OIDCIssuer)
+	}
+	if c.ProxyURL != "" {
+		u, err := url.Parse(c.ProxyURL)
+		if err != nil {
+			fatal("invalid proxy url", "err", err)
+		}
+		slog.Info("outbound requests will use proxy", "url", u.Redacted())
+	}
+	if c.OTLPEndpoint != "" {
+		if err := tracing(c); err != nil {
+			fatal("tracing failed", "err", err)
+		}
+		slog.Info("exporting traces", "endpoint", c.OTLPEndpoint)
+	}
+	h := &handler.Handler{Config: c, Level: level}
+	if c.ConfigFile != "" {
+		go reload(h)
+	}
+	if c.Token != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		rl, err := h.CheckToken(ctx)
+		cancel()
+		if err != nil && c.StrictToken {
+			fatal("github token check failed", "err", err)
+		} else if err != nil {
+			slog.Warn("github token check failed", "err", err)
+		} else {
+			scopes := "none reported"
+			if len(rl.Scopes) > 0 {
+				scopes = strings.Join(rl.Scopes, ",")
+			}
+			slog.Info("github token ok", "remaining", rl.Remaining, "limit", rl.Limit,
+				"reset", rl.Reset.Format(time.Kitchen), "scopes", scopes)
+		}
+	}
+	if c.DebugAddr != "" {
+		go func() {
+			slog.Info("serving pprof and expvar", "addr", c.DebugAddr)
+			fatal("debug listener failed", "err", http.ListenAndServe(c.DebugAddr, debugMux()))
+		}()
+	}
+	//serverless, requests arrive via the lambda runtime api
+	if runtime := os.Getenv("AWS_LAMBDA_RUNTIME_API"); runtime != "" {
+		slog.Info("serving lambda invocations", "api", runtime)
+		fatal("lambda runtime failed", "err", lambda.Serve(runtime, h))
 	}
 	addr := fmt.Sprintf("%s:%d", c.Host, c.Port)
 	l, err := net.Listen("tcp4", addr)
 	if err != nil {
-		log.Fatal(err)
-	}
-	log.Printf("listening on %s...", addr)
-	h := &handler.Handler{Config: c}
-	lh := requestlog.WrapWith(h, requestlog.Options{
-		TrustProxy: true, // assume will be run in paas
-		Filter: func(r *http.Request, code int, duration time.Duration, size int64) bool {
-			return r.URL.Path != "/healthz"
-		},
-	})
-	if err := http.Serve(l, lh); err != nil {
-		log.Fatal(err)
-	}
-	log.Print("exiting")
+		fatal("listen failed", "err", err)
+	}
+	if domains := handler.SplitList(c.ACMEDomains); len(domains) > 0 {
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(domains...),
+			Cache:      autocert.DirCache(c.ACMEDir),
+			Email:      c.ACMEEmail,
+		}
+		if c.ACMEHTTPPort > 0 {
+			go func() {
+				addr := fmt.Sprintf("%s:%d", c.Host, c.ACMEHTTPPort)
+				slog.Info("serving acme challenges and https redirects", "addr", addr)
+				fatal("acme listener failed", "err", http.ListenAndServe(addr, m.HTTPHandler(nil)))
+			}()
+		}
+		l = tls.NewListener(l, m.TLSConfig())
+		slog.Info("serving https", "domains", strings.Join(domains, ","))
+	}
+	slog.Info("listening", "addr", addr)
+	if c.Privacy {
+		slog.Info("privacy mode, client ips will not be logged")
+	}
+	var th http.Handler = h
+	if c.OTLPEndpoint != "" {
+		th = otelhttp.NewHandler(h, "installer")
+	}
+	if err := sdNotify("READY=1"); err != nil {
+		slog.Warn("systemd notify failed", "err", err)
+	}
+	go watchdog(h)
+	if err := http.Serve(l, th); err != nil {
+		fatal("serve failed", "err", err)
+	}
+	slog.Info("exiting")
+}
+
+// logger installs the configured default slog logger,
+// returning its adjustable level
+func logger(c handler.Config) (*slog.LevelVar, error) {
+	level := &slog.LevelVar{}
+	if err := level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		return nil, err
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	switch c.LogFormat {
+	case "text":
+		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, opts)))
+	case "json":
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, opts)))
+	default:
+		return nil, fmt.Errorf("unknown log format %q", c.LogFormat)
+	}
+	return level, nil
+}
+
+// reload applies the config file on each SIGHUP
+func reload(h *handler.Handler) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		if err := h.Reload(); err != nil {
+			slog.Error("config reload failed", "err", err)
+		}
+	}
+}
+
+// fatal logs an error and exits
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
 }
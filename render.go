@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/jpillora/installer/handler"
+	"github.com/jpillora/installer/installer"
+)
+
+// renderCmd prints a pinned script, so maintainers can vendor a
+// reviewed script instead of depending on a server at install time
+type renderCmd struct {
+	Repo  string `opts:"mode=arg, help=user/repo to render (optionally pinned with @release)"`
+	Type  string `opts:"help=sh (bash) or posix or homebrew or text or offline or uninstall, default=sh"`
+	OS    string `opts:"help=only include the asset for this os (e.g. linux)"`
+	Arch  string `opts:"help=only include the asset for this arch (e.g. arm64)"`
+	Dir   string `opts:"help=install directory used by the script"`
+	Move  bool   `opts:"help=move the binary into /usr/local/bin"`
+	Token string `opts:"help=github api token (for private repos and higher rate limits), env=GITHUB_TOKEN"`
+}
+
+func (rc *renderCmd) Run() error {
+	q, err := parseRepo(rc.Repo)
+	if err != nil {
+		return err
+	}
+	q.Dir = rc.Dir
+	q.MoveToPath = rc.Move
+	tmpl := ""
+	switch rc.Type {
+	case "", "sh", "bash", "script":
+		tmpl = "script"
+	case "posix", "homebrew", "text", "offline", "uninstall":
+		tmpl = rc.Type
+	default:
+		return fmt.Errorf("unknown type %q", rc.Type)
+	}
+	c := handler.DefaultConfig
+	c.Token = rc.Token
+	r := installer.NewResolver(c)
+	result, err := r.Resolve(context.Background(), q)
+	if err != nil {
+		return err
+	}
+	if result, err = installer.Only(result, rc.OS, rc.Arch); err != nil {
+		return err
+	}
+	return r.Render(os.Stdout, result, tmpl)
+}
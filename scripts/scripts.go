@@ -10,3 +10,36 @@ var Shell []byte
 
 //go:embed install.rb.tmpl
 var Homebrew []byte
+
+//go:embed install.posix.sh.tmpl
+var Posix []byte
+
+//go:embed install.ps1.tmpl
+var PowerShell []byte
+
+//go:embed error.sh.tmpl
+var ErrorShell []byte
+
+//go:embed error.txt.tmpl
+var ErrorText []byte
+
+//go:embed error.html.tmpl
+var ErrorHTML []byte
+
+//go:embed uninstall.sh.tmpl
+var Uninstall []byte
+
+//go:embed offline.txt.tmpl
+var Offline []byte
+
+//go:embed page.html.tmpl
+var Page []byte
+
+//go:embed index.html.tmpl
+var Index []byte
+
+//go:embed badge.svg.tmpl
+var Badge []byte
+
+//go:embed tap.rb.tmpl
+var Tap []byte
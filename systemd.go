@@ -0,0 +1,53 @@
+package main
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"time"
+)
+
+// sdNotify sends a state to systemd when running as a
+// Type=notify service, and is a no-op otherwise
+func sdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	conn, err := net.Dial("unixgram", socket)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// watchdog pets the systemd watchdog at half its interval,
+// only while the handler still answers health checks, so
+// a hung server gets restarted
+func watchdog(h http.Handler) {
+	usec, _ := strconv.Atoi(os.Getenv("WATCHDOG_USEC"))
+	if usec <= 0 {
+		return
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return
+	}
+	interval := time.Duration(usec) * time.Microsecond / 2
+	slog.Info("systemd watchdog enabled", "interval", interval)
+	for range time.Tick(interval) {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+		if w.Code != http.StatusOK {
+			slog.Warn("health check failed, skipping watchdog", "status", w.Code)
+			continue
+		}
+		if err := sdNotify("WATCHDOG=1"); err != nil {
+			slog.Warn("systemd watchdog failed", "err", err)
+		}
+	}
+}